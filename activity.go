@@ -0,0 +1,88 @@
+package mrun
+
+import (
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// WithBellForwarding forwards bells (BEL characters) in the output of commands
+// to the terminal, which may e.g. beep or mark the window as urgent. Regardless,
+// inactive panes with unseen output are highlighted, and flagged with # in the
+// bottom border, or ! if they rang the bell.
+func WithBellForwarding() RunOption {
+	return func(o *runOpts) {
+		o.forwardBell = true
+	}
+}
+
+// stripBells removes BEL characters from a line of output, returning whether
+// there were any. BEL characters terminating OSC sequences, e.g. window titles
+// and hyperlinks, are kept.
+func stripBells(line string) (string, bool) {
+	if !strings.Contains(line, "\a") {
+		return line, false
+	}
+	var b strings.Builder
+	var bell, inOSC bool
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '\x1b' && i+1 < len(line) && line[i+1] == ']':
+			inOSC = true
+		case c == '\x1b' && i+1 < len(line) && line[i+1] == '\\':
+			inOSC = false
+		case c == '\a' && inOSC:
+			inOSC = false
+		case c == '\a':
+			bell = true
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String(), bell
+}
+
+// ringBell returns a command writing a BEL character to the terminal.
+func ringBell(out *terminalOutput) tea.Cmd {
+	return func() tea.Msg {
+		_, _ = out.WriteString("\a")
+		return nil
+	}
+}
+
+// markActivity records unseen output, and a bell if rung, in the pane unless
+// it's the active pane.
+func (m *model) markActivity(idx int, bell bool) {
+	if idx == m.activePane {
+		return
+	}
+	m.panes[idx].activity = true
+	if bell {
+		m.panes[idx].bell = true
+	}
+}
+
+// nextActivePane returns the index of the next pane after the active one with
+// unseen output or a bell, or -1 if there's none.
+func (m model) nextActivePane() int {
+	for i := 1; i < m.count; i++ {
+		idx := (m.activePane + i) % m.count
+		if m.panes[idx].activity || m.panes[idx].bell {
+			return idx
+		}
+	}
+	return -1
+}
+
+// activityFlags renders the flags of a pane with unseen output (#) or a bell
+// (!), like tmux.
+func (p *modelPane) activityFlags(style func(string) string) string {
+	switch {
+	case p.bell:
+		return p.styles.warning.Render("! ")
+	case p.activity:
+		return style("# ")
+	}
+	return ""
+}
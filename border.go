@@ -0,0 +1,96 @@
+package mrun
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// PaneBorder is the border style of panes, see [WithBorder].
+type PaneBorder int
+
+const (
+	// Right and bottom borders only, the default.
+	BorderMinimal PaneBorder = iota
+	BorderNormal
+	BorderRounded
+	BorderDouble
+	BorderThick
+)
+
+// WithBorder sets the border style of panes. Except with [BorderMinimal], the
+// default, panes have full borders, with the title, PID and running duration
+// of the command shown in the top border instead of the bottom one.
+func WithBorder(border PaneBorder) RunOption {
+	return func(o *runOpts) {
+		o.border = border
+	}
+}
+
+// paneStyle returns the base style of panes with the border.
+func paneStyle(r *lipgloss.Renderer, border PaneBorder) lipgloss.Style {
+	style := r.NewStyle()
+	switch border {
+	case BorderNormal:
+		return style.Border(lipgloss.NormalBorder())
+	case BorderRounded:
+		return style.Border(lipgloss.RoundedBorder())
+	case BorderDouble:
+		return style.Border(lipgloss.DoubleBorder())
+	case BorderThick:
+		return style.Border(lipgloss.ThickBorder())
+	default:
+		return style.
+			BorderStyle(lipgloss.NormalBorder()).
+			BorderTop(false).
+			BorderRight(true).
+			BorderBottom(true).
+			BorderLeft(false)
+	}
+}
+
+// topBorderText returns the text shown in the top border of the pane: the
+// title, PID and running duration of the command, truncated to width.
+func (p *modelPane) topBorderText(width int) string {
+	parts := []string{p.title}
+	if p.pid > 0 {
+		parts = append(parts, fmt.Sprintf("PID %d", p.pid))
+	}
+	if d := p.elapsed(); d != "" {
+		parts = append(parts, d)
+	}
+	return ansi.Truncate(" "+strings.Join(parts, " · ")+" ", width, "… ")
+}
+
+// elapsed returns the formatted running duration of the pane's command, live
+// while it's running and final once it's done, or "" if it wasn't started.
+func (p *modelPane) elapsed() string {
+	if p.cmd.startTime.IsZero() {
+		return ""
+	}
+	end := p.endTime
+	if end.IsZero() {
+		end = time.Now()
+	}
+	return formatDuration(end.Sub(p.cmd.startTime))
+}
+
+// formatDuration formats a duration with a precision of one second, e.g. 5s,
+// 1m05s or 2h03m04s.
+func formatDuration(d time.Duration) string {
+	d = d.Truncate(time.Second)
+	h := int(d.Hours())
+	m := int(d.Minutes()) % 60
+	s := int(d.Seconds()) % 60
+	switch {
+	case h > 0:
+		return fmt.Sprintf("%dh%02dm%02ds", h, m, s)
+	case m > 0:
+		return fmt.Sprintf("%dm%02ds", m, s)
+	default:
+		return fmt.Sprintf("%ds", s)
+	}
+}
@@ -0,0 +1,443 @@
+// Command mrun runs multiple commands simultaneously in a TUI grid.
+//
+// Usage:
+//
+//	mrun [options] [[command options] command]...
+//
+// Each command is a command line run with sh. Command options apply to the
+// command following them. For example:
+//
+//	mrun -c 2 --label web 'npm run dev' --label api 'go run ./api'
+//
+// Commands and options can also be loaded from a config file (see
+// [mrun.LoadConfig]) with --config; options given on the command line take
+// precedence, and commands given on the command line are appended. Similarly,
+// processes can be loaded from a Procfile (see [mrun.LoadProcfile]) with
+// --procfile.
+//
+// The exit status is 0 if all commands were successful, 1 otherwise, and 2 on
+// usage errors.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/zmwangx/mrun"
+)
+
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringsFlag) Set(s string) error {
+	*f = append(*f, s)
+	return nil
+}
+
+// commandFlags holds the options applying to the next command.
+type commandFlags struct {
+	label             string
+	cmdline           string
+	env               stringsFlag
+	envFiles          stringsFlag
+	cleanEnv          bool
+	envUnset          stringsFlag
+	envPassthrough    stringsFlag
+	dir               string
+	readyOutput       string
+	readyPort         int
+	readyFile         string
+	successCodes      string
+	allowFailure      bool
+	commandTimestamps string
+	filter            string
+	invertFilter      bool
+	noWrap            bool
+	stallWarning      time.Duration
+	stallTimeout      time.Duration
+	progress          bool
+	highlights        stringsFlag
+}
+
+func (f *commandFlags) options() ([]mrun.CommandOption, error) {
+	var opts []mrun.CommandOption
+	if f.label != "" {
+		opts = append(opts, mrun.WithLabel(f.label))
+	}
+	if f.cmdline != "" {
+		opts = append(opts, mrun.WithCommandLine(f.cmdline))
+	}
+	if len(f.env) > 0 {
+		opts = append(opts, mrun.WithEnv(f.env))
+	}
+	for _, path := range f.envFiles {
+		opts = append(opts, mrun.WithEnvFile(path))
+	}
+	if f.cleanEnv {
+		opts = append(opts, mrun.WithCleanEnv())
+	}
+	if len(f.envUnset) > 0 {
+		opts = append(opts, mrun.WithEnvUnset(f.envUnset...))
+	}
+	if len(f.envPassthrough) > 0 {
+		opts = append(opts, mrun.WithEnvPassthrough(f.envPassthrough...))
+	}
+	if f.dir != "" {
+		opts = append(opts, mrun.WithDir(f.dir))
+	}
+	var probes []mrun.ReadyProbe
+	if f.readyOutput != "" {
+		re, err := regexp.Compile(f.readyOutput)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --ready-output: %w", err)
+		}
+		probes = append(probes, mrun.ReadyOnOutput(re))
+	}
+	if f.readyPort > 0 {
+		probes = append(probes, mrun.ReadyOnPort(f.readyPort))
+	}
+	if f.readyFile != "" {
+		probes = append(probes, mrun.ReadyOnFile(f.readyFile))
+	}
+	if len(probes) > 0 {
+		opts = append(opts, mrun.WithReadyWhen(probes...))
+	}
+	if f.successCodes != "" {
+		var codes []int
+		for _, s := range strings.Split(f.successCodes, ",") {
+			code, err := strconv.Atoi(strings.TrimSpace(s))
+			if err != nil {
+				return nil, fmt.Errorf("invalid --success-codes: %w", err)
+			}
+			codes = append(codes, code)
+		}
+		opts = append(opts, mrun.WithSuccessExitCodes(codes...))
+	}
+	if f.allowFailure {
+		opts = append(opts, mrun.WithAllowFailure())
+	}
+	if f.commandTimestamps != "" {
+		opts = append(opts, mrun.WithCommandTimestamps(f.commandTimestamps))
+	}
+	if f.filter != "" {
+		re, err := regexp.Compile(f.filter)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --filter: %w", err)
+		}
+		opts = append(opts, mrun.WithFilter(re, f.invertFilter))
+	}
+	if f.noWrap {
+		opts = append(opts, mrun.WithCommandNoWrap())
+	}
+	if f.stallWarning > 0 {
+		opts = append(opts, mrun.WithStallWarning(f.stallWarning))
+	}
+	if f.stallTimeout > 0 {
+		opts = append(opts, mrun.WithStallTimeout(f.stallTimeout))
+	}
+	if f.progress {
+		opts = append(opts, mrun.WithProgress(nil))
+	}
+	for _, h := range f.highlights {
+		re, style, err := parseHighlight("--command-highlight", h)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, mrun.WithCommandHighlight(re, style))
+	}
+	return opts, nil
+}
+
+// parseHighlight parses the COLOR=REGEX value of a highlight flag.
+func parseHighlight(flag, value string) (*regexp.Regexp, lipgloss.Style, error) {
+	color, pattern, ok := strings.Cut(value, "=")
+	if !ok {
+		return nil, lipgloss.Style{}, fmt.Errorf("%s must be in the form COLOR=REGEX", flag)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, lipgloss.Style{}, fmt.Errorf("invalid %s: %w", flag, err)
+	}
+	return re, lipgloss.NewStyle().Foreground(lipgloss.Color(color)), nil
+}
+
+const _usage = `usage: mrun [options] [[command options] command]...
+
+Run multiple commands simultaneously in a TUI grid. Each command is a command
+line run with sh. Command options apply to the command following them.
+
+Options:
+  -f, --config FILE          load commands and options from YAML config FILE
+  -p, --procfile FILE        load processes from Procfile FILE
+  --env-file FILE            dotenv file for Procfile processes
+                             (default .env next to the Procfile)
+  --port PORT                base port for Procfile processes (default 5000,
+                             0 to disable PORT assignment)
+  -c, --columns N            number of columns in the grid (default 1)
+  --command-lines            print the command line before output in each pane
+  --auto-quit                quit automatically after all commands are done
+  --final-view               leave a final view of the grid on screen
+  --fail-fast                terminate all commands as soon as one fails
+  --timestamps FORMAT        show line timestamps in Go time layout FORMAT,
+                             or "elapsed" for time since command start
+  --highlight COLOR=REGEX    highlight matches of REGEX in ANSI or hex COLOR
+                             (repeatable)
+  --theme THEME              color theme: dark (default), light,
+                             high-contrast or no-color
+  --border STYLE             pane border style: minimal (default), normal,
+                             rounded, double or thick
+  --no-wrap                  cut long lines instead of wrapping them
+  --forward-bell             forward bells in the output to the terminal
+  --help-footer              show help for common keys below the grid
+
+Command options:
+  --label LABEL              label shown at the bottom of the pane
+  --cmdline CMDLINE          command line shown instead of the actual one
+  --env KEY=VALUE            set environment variable (repeatable)
+  --command-env-file FILE    load environment variables from dotenv FILE
+                             (repeatable)
+  --clean-env                do not inherit the environment
+  --env-unset KEY            remove KEY from the inherited environment
+                             (repeatable)
+  --env-passthrough PATTERN  only inherit variables matching glob PATTERN
+                             (repeatable)
+  --dir DIR                  working directory; ${VAR} is expanded from the
+                             command's environment
+  --ready-output REGEX       ready when a line of output matches REGEX
+  --ready-port PORT          ready when PORT on localhost accepts connections
+  --ready-file PATH          ready when PATH exists
+  --success-codes CODES      comma-separated exit codes considered successful
+  --allow-failure            do not count failure of the command
+  --command-timestamps FORMAT
+                             like --timestamps, for the command only
+  --filter REGEX             only show lines of output matching REGEX
+  --invert-filter            only show lines not matching --filter instead
+  --command-no-wrap          like --no-wrap, for the command only
+  --stall-warning DURATION   mark the pane as stalled after no output for
+                             DURATION, e.g. 2m
+  --stall-timeout DURATION   terminate the command after no output for
+                             DURATION
+  --progress                 show progress parsed from the output, e.g. 42%
+                             or 3/10, in the pane and the window title
+  --command-highlight COLOR=REGEX
+                             like --highlight, for the command only
+                             (repeatable)
+
+Some options of the mrun library have no flags: custom key maps, themes and
+progress extractors, event handlers, and expansion of ${VAR} in arguments,
+which the shell already does.
+`
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	var (
+		config       string
+		procfile     string
+		envFile      string
+		port         int
+		cols         int
+		commandLines bool
+		autoQuit     bool
+		finalView    bool
+		failFast     bool
+		timestamps   string
+		highlights   stringsFlag
+		theme        string
+		border       string
+		noWrap       bool
+		forwardBell  bool
+		helpFooter   bool
+		cf           commandFlags
+	)
+	fs := flag.NewFlagSet("mrun", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(fs.Output(), _usage) }
+	fs.StringVar(&config, "f", "", "")
+	fs.StringVar(&config, "config", "", "")
+	fs.StringVar(&procfile, "p", "", "")
+	fs.StringVar(&procfile, "procfile", "", "")
+	fs.StringVar(&envFile, "env-file", "", "")
+	fs.IntVar(&port, "port", 5000, "")
+	fs.IntVar(&cols, "c", 1, "")
+	fs.IntVar(&cols, "columns", 1, "")
+	fs.BoolVar(&commandLines, "command-lines", false, "")
+	fs.BoolVar(&autoQuit, "auto-quit", false, "")
+	fs.BoolVar(&finalView, "final-view", false, "")
+	fs.BoolVar(&failFast, "fail-fast", false, "")
+	fs.StringVar(&timestamps, "timestamps", "", "")
+	fs.Var(&highlights, "highlight", "")
+	fs.StringVar(&theme, "theme", "", "")
+	fs.StringVar(&border, "border", "", "")
+	fs.BoolVar(&noWrap, "no-wrap", false, "")
+	fs.BoolVar(&forwardBell, "forward-bell", false, "")
+	fs.BoolVar(&helpFooter, "help-footer", false, "")
+	fs.StringVar(&cf.label, "label", "", "")
+	fs.StringVar(&cf.cmdline, "cmdline", "", "")
+	fs.Var(&cf.env, "env", "")
+	fs.Var(&cf.envFiles, "command-env-file", "")
+	fs.BoolVar(&cf.cleanEnv, "clean-env", false, "")
+	fs.Var(&cf.envUnset, "env-unset", "")
+	fs.Var(&cf.envPassthrough, "env-passthrough", "")
+	fs.StringVar(&cf.dir, "dir", "", "")
+	fs.StringVar(&cf.readyOutput, "ready-output", "", "")
+	fs.IntVar(&cf.readyPort, "ready-port", 0, "")
+	fs.StringVar(&cf.readyFile, "ready-file", "", "")
+	fs.StringVar(&cf.successCodes, "success-codes", "", "")
+	fs.BoolVar(&cf.allowFailure, "allow-failure", false, "")
+	fs.StringVar(&cf.commandTimestamps, "command-timestamps", "", "")
+	fs.StringVar(&cf.filter, "filter", "", "")
+	fs.BoolVar(&cf.invertFilter, "invert-filter", false, "")
+	fs.BoolVar(&cf.noWrap, "command-no-wrap", false, "")
+	fs.DurationVar(&cf.stallWarning, "stall-warning", 0, "")
+	fs.DurationVar(&cf.stallTimeout, "stall-timeout", 0, "")
+	fs.BoolVar(&cf.progress, "progress", false, "")
+	fs.Var(&cf.highlights, "command-highlight", "")
+
+	// Parse repeatedly, since flag parsing stops at the first non-flag
+	// argument, i.e. a command; command options are reset after each command.
+	var commands []*mrun.Command
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return 0
+			}
+			return 2
+		}
+		if fs.NArg() == 0 {
+			// Command options apply to the following command; don't silently
+			// drop trailing ones.
+			if !reflect.DeepEqual(cf, commandFlags{}) {
+				fmt.Fprintln(os.Stderr, "mrun: command options must be followed by a command")
+				return 2
+			}
+			break
+		}
+		opts, err := cf.options()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "mrun: %s\n", err)
+			return 2
+		}
+		commands = append(commands, mrun.NewCommandWithShell(fs.Arg(0), opts...))
+		cf = commandFlags{}
+		args = fs.Args()[1:]
+	}
+
+	var opts []mrun.RunOption
+	if config != "" {
+		configCommands, configOpts, err := mrun.LoadConfig(config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "mrun: %s\n", err)
+			return 2
+		}
+		commands = append(configCommands, commands...)
+		opts = configOpts
+	}
+	if procfile != "" {
+		procfileOpts := []mrun.ProcfileOption{mrun.WithProcfileBasePort(port)}
+		if envFile != "" {
+			procfileOpts = append(procfileOpts, mrun.WithProcfileEnvFile(envFile))
+		}
+		procfileCommands, err := mrun.LoadProcfile(procfile, procfileOpts...)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "mrun: %s\n", err)
+			return 2
+		}
+		commands = append(procfileCommands, commands...)
+	}
+	if len(commands) == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	// Only apply options explicitly set on the command line, so that they
+	// don't override those from the config file with defaults.
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if set["c"] || set["columns"] {
+		opts = append(opts, mrun.WithColumns(cols))
+	}
+	if commandLines {
+		opts = append(opts, mrun.WithCommandLines())
+	}
+	if autoQuit {
+		opts = append(opts, mrun.WithAutoQuit())
+	}
+	if finalView {
+		opts = append(opts, mrun.WithFinalView())
+	}
+	if failFast {
+		opts = append(opts, mrun.WithFailFast())
+	}
+	if timestamps != "" {
+		opts = append(opts, mrun.WithTimestamps(timestamps))
+	}
+	if noWrap {
+		opts = append(opts, mrun.WithNoWrap())
+	}
+	if forwardBell {
+		opts = append(opts, mrun.WithBellForwarding())
+	}
+	if helpFooter {
+		opts = append(opts, mrun.WithHelpFooter())
+	}
+	if theme != "" {
+		themes := map[string]func() mrun.Theme{
+			"dark":          mrun.DarkTheme,
+			"light":         mrun.LightTheme,
+			"high-contrast": mrun.HighContrastTheme,
+			"no-color":      mrun.NoColorTheme,
+		}
+		t, ok := themes[theme]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "mrun: unknown theme %q\n", theme)
+			return 2
+		}
+		opts = append(opts, mrun.WithTheme(t()))
+	}
+	if border != "" {
+		borders := map[string]mrun.PaneBorder{
+			"minimal": mrun.BorderMinimal,
+			"normal":  mrun.BorderNormal,
+			"rounded": mrun.BorderRounded,
+			"double":  mrun.BorderDouble,
+			"thick":   mrun.BorderThick,
+		}
+		b, ok := borders[border]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "mrun: unknown border %q\n", border)
+			return 2
+		}
+		opts = append(opts, mrun.WithBorder(b))
+	}
+	for _, h := range highlights {
+		re, style, err := parseHighlight("--highlight", h)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "mrun: %s\n", err)
+			return 2
+		}
+		opts = append(opts, mrun.WithHighlight(re, style))
+	}
+
+	_, ok, err := mrun.Run(commands, opts...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mrun: %s\n", err)
+		return 1
+	}
+	if !ok {
+		return 1
+	}
+	return 0
+}
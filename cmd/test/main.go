@@ -6,6 +6,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 
 	"github.com/zmwangx/mrun"
 )
@@ -51,6 +52,8 @@ func main() {
 			exec.Command("./testprog"),
 			mrun.WithDir(tmpdir),
 			mrun.WithLabel(fmt.Sprintf("test %d", i)),
+			// Test readiness probe.
+			mrun.WithReadyWhen(mrun.ReadyOnOutput(regexp.MustCompile(`\[0005\]`))),
 		))
 	}
 	commands, ok, err := mrun.Run(
@@ -3,6 +3,12 @@ package mrun
 import (
 	"os"
 	"os/exec"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"al.essio.dev/pkg/shellescape"
 )
@@ -11,9 +17,54 @@ type Command struct {
 	cmd     *exec.Cmd
 	cmdline string
 	label   string
-	done    bool
+	// Set by NewCommandWithShell.
+	shell bool
+	// Environment options applied in prepare().
+	cleanEnv       bool
+	envUnset       []string
+	envPassthrough []string
+	envFiles       []string
+	env            []string
+	// See WithExpandVars.
+	expandArgs bool
+	// Set by prepare() right before the command is started.
+	started bool
+	// Copy of cmd before it was first prepared, for restarts.
+	orig *exec.Cmd
+	// Format of the timestamps gutter; see WithCommandTimestamps.
+	timestampFormat string
+	// Initial filter of the pane; see WithFilter.
+	filter       *regexp.Regexp
+	filterInvert bool
+	highlights   []highlight
+	noWrap       bool
+	// See WithStallWarning and WithStallTimeout.
+	stallWarning time.Duration
+	stallTimeout time.Duration
+	// See WithProgress.
+	progress ProgressFunc
+	// Set by runCommand() when the command is started, and once it's done.
+	startTime time.Time
+	endTime   time.Time
+	done      bool
+	// Set when the command is being terminated on its own (e.g. when removed
+	// from the grid), in which case the process is waited in
+	// gracefullyTerminate().
+	terminating atomic.Bool
+	probes      []ReadyProbe
+	ready       atomic.Bool
+	// Exit codes considered successful; only 0 if empty.
+	successCodes []int
+	allowFailure bool
+	// Set when the command exited with a successful exit code.
+	succeeded bool
+	// Set when the command was terminated in fail-fast mode due to the
+	// failure of another command.
+	cancelled bool
 	// The error from running the command will be stored here.
 	err error
+	// Closed when the command is done and its output has been sent.
+	finished chan struct{}
 }
 
 type CommandOption func(*Command)
@@ -55,18 +106,66 @@ func WithCommandLine(cmdline string) CommandOption {
 	}
 }
 
-// WithEnv sets the environment of the command.
+// WithCommandTimestamps shows the arrival time of each line of output in a
+// gutter to the left of the command's output, overriding [WithTimestamps]. See
+// [WithTimestamps] for the format.
+func WithCommandTimestamps(format string) CommandOption {
+	return func(c *Command) {
+		c.timestampFormat = format
+	}
+}
+
+// WithSuccessExitCodes sets the exit codes considered successful, replacing the
+// default of 0 only. Useful for commands like diff and grep where exit code 1
+// does not indicate an error. Command.Err() is nil for a command that exited
+// with one of these codes.
+func WithSuccessExitCodes(codes ...int) CommandOption {
+	return func(c *Command) {
+		c.successCodes = codes
+	}
+}
+
+// WithAllowFailure marks the command as allowed to fail: its failure is shown
+// as a warning rather than an error, and does not affect the allSuccessful
+// result of [Run] or trigger [WithFailFast].
+func WithAllowFailure() CommandOption {
+	return func(c *Command) {
+		c.allowFailure = true
+	}
+}
+
+// WithEnv sets environment variables for the command, on top of the
+// environment it would otherwise have, i.e. cmd.Env, or the current process's
+// environment if cmd.Env is nil. It's roughly equivalent to:
 //
-// It's a convenience function equivalent to manually setting the Env field of
-// cmd before calling NewCommand:
+//	cmd.Env = append(cmd.Environ(), env...)
 //
-//	cmd.Env = append(os.Environ(), env...)
+// except that the environment is computed when the command is started, so
+// that variables from [WithEnvFile] can be overridden. WithEnv can be used
+// multiple times.
 //
-// Note: you need to manually set Env on the exec.Cmd if you don't want to
-// inherit the current process's environment.
+// To not inherit the current process's environment, use [WithCleanEnv],
+// [WithEnvPassthrough] or [WithEnvUnset].
 func WithEnv(env []string) CommandOption {
 	return func(c *Command) {
-		c.cmd.Env = append(os.Environ(), env...)
+		c.env = append(c.env, env...)
+	}
+}
+
+// WithEnvFile loads environment variables for the command from a dotenv file
+// when the command is started. Supported syntax:
+//
+//	# Comment
+//	KEY=value # Trailing comment
+//	export KEY=value
+//	KEY='literal value'
+//	KEY="value with \"escapes\"\n"
+//
+// Variables set with [WithEnv] take precedence. Errors loading the file are
+// shown in the pane of the command.
+func WithEnvFile(path string) CommandOption {
+	return func(c *Command) {
+		c.envFiles = append(c.envFiles, path)
 	}
 }
 
@@ -76,24 +175,255 @@ func WithEnv(env []string) CommandOption {
 // cmd before calling NewCommand:
 //
 //	cmd.Dir = dir
+//
+// ${VAR} references in the directory are always expanded with the environment
+// of the command (see [Command.Environ]) when it's started. Referencing an
+// undefined variable is an error, shown in the pane of the command. Use
+// [WithExpandVars] to expand them in the arguments too.
 func WithDir(dir string) CommandOption {
 	return func(c *Command) {
 		c.cmd.Dir = dir
 	}
 }
 
+// WithExpandVars expands ${VAR} references in the arguments of the command with
+// the environment of the command (see [Command.Environ]) when it's started,
+// e.g. to use variables from [WithEnvFile]. Other uses of $ are left alone.
+// Referencing an undefined variable is an error, shown in the pane of the
+// command. ${VAR} references in the working directory are always expanded.
+//
+// It has no effect on commands created with [NewCommandWithShell], since the
+// shell already expands variables.
+func WithExpandVars() CommandOption {
+	return func(c *Command) {
+		c.expandArgs = true
+	}
+}
+
+// WithCleanEnv starts the command with an empty environment instead of
+// inheriting cmd.Env or the current process's environment. Variables can then
+// be added back with [WithEnvPassthrough], [WithEnvFile] and [WithEnv].
+func WithCleanEnv() CommandOption {
+	return func(c *Command) {
+		c.cleanEnv = true
+	}
+}
+
+// WithEnvUnset removes variables from the inherited environment of the
+// command. Variables set with [WithEnvFile] or [WithEnv] are not affected.
+func WithEnvUnset(keys ...string) CommandOption {
+	return func(c *Command) {
+		c.envUnset = append(c.envUnset, keys...)
+	}
+}
+
+// WithEnvPassthrough restricts the inherited environment of the command to
+// variables whose names match one of the patterns, in [path.Match] syntax,
+// e.g. "PATH" or "GO*". It implies [WithCleanEnv] for everything else.
+func WithEnvPassthrough(patterns ...string) CommandOption {
+	return func(c *Command) {
+		c.envPassthrough = append(c.envPassthrough, patterns...)
+	}
+}
+
+// customEnv reports whether any of the environment options are used.
+func (c *Command) customEnv() bool {
+	return c.cleanEnv || len(c.envUnset) > 0 || len(c.envPassthrough) > 0 ||
+		len(c.envFiles) > 0 || len(c.env) > 0
+}
+
+// environ computes the environment of the command. The environment options
+// are applied in a fixed order regardless of the order in which they are
+// given: the inherited environment (none with [WithCleanEnv], filtered by
+// [WithEnvPassthrough] and [WithEnvUnset]), then [WithEnvFile], then
+// [WithEnv]. Later values of a variable take precedence over earlier ones.
+func (c *Command) environ() ([]string, error) {
+	if !c.customEnv() {
+		return c.cmd.Environ(), nil
+	}
+	var env []string
+	if !c.cleanEnv || len(c.envPassthrough) > 0 {
+		inherited := c.cmd.Env
+		if inherited == nil {
+			inherited = os.Environ()
+		}
+		for _, kv := range inherited {
+			key, _, _ := strings.Cut(kv, "=")
+			if len(c.envPassthrough) > 0 && !slices.ContainsFunc(c.envPassthrough, func(pattern string) bool {
+				ok, _ := path.Match(pattern, key)
+				return ok
+			}) {
+				continue
+			}
+			if slices.Contains(c.envUnset, key) {
+				continue
+			}
+			env = append(env, kv)
+		}
+	}
+	for _, file := range c.envFiles {
+		fileEnv, err := loadDotenv(file)
+		if err != nil {
+			return nil, err
+		}
+		env = append(env, fileEnv...)
+	}
+	env = append(env, c.env...)
+	return dedupEnv(env), nil
+}
+
+// Environ returns the environment the command is (or will be) run with, for
+// debugging. Environment files that fail to load are skipped; the error is
+// shown in the pane when the command is started.
+func (c *Command) Environ() []string {
+	if c.started {
+		return c.cmd.Environ()
+	}
+	env, err := c.environ()
+	if err != nil {
+		// Skip the env files, see environ.
+		envFiles := c.envFiles
+		c.envFiles = nil
+		env, _ = c.environ()
+		c.envFiles = envFiles
+	}
+	return env
+}
+
+// prepare finalizes the command right before it is started: the environment is
+// computed (see [Command.Environ]), and ${VAR} references in the working
+// directory, and in the arguments with [WithExpandVars], are expanded using
+// that environment.
+func (c *Command) prepare() error {
+	c.started = true
+	if c.orig == nil {
+		c.orig = cloneCmd(c.cmd)
+	}
+	if c.customEnv() {
+		env, err := c.environ()
+		if err != nil {
+			return err
+		}
+		c.cmd.Env = env
+	}
+	environ := c.cmd.Environ()
+
+	if c.expandArgs && !c.shell && len(c.cmd.Args) > 0 {
+		args := make([]string, len(c.cmd.Args))
+		for i, arg := range c.cmd.Args {
+			expanded, err := expandVars(arg, environ)
+			if err != nil {
+				return err
+			}
+			args[i] = expanded
+		}
+		if args[0] != c.cmd.Args[0] {
+			// Resolve the expanded command name like exec.Command does.
+			path, err := exec.LookPath(args[0])
+			if err != nil {
+				return err
+			}
+			c.cmd.Path = path
+			c.cmd.Err = nil
+		}
+		c.cmd.Args = args
+	}
+	dir, err := expandVars(c.cmd.Dir, environ)
+	if err != nil {
+		return err
+	}
+	c.cmd.Dir = dir
+	return nil
+}
+
+// reset resets the command after it's done so that it can be run again, e.g.
+// when restarted from its pane.
+func (c *Command) reset() {
+	if c.orig != nil {
+		c.cmd = cloneCmd(c.orig)
+	}
+	c.started = false
+	c.startTime = time.Time{}
+	c.endTime = time.Time{}
+	c.done = false
+	c.terminating.Store(false)
+	c.ready.Store(false)
+	c.succeeded = false
+	c.cancelled = false
+	c.err = nil
+}
+
+// cloneCmd returns an unstarted copy of cmd with the same path, arguments,
+// environment and working directory.
+func cloneCmd(cmd *exec.Cmd) *exec.Cmd {
+	return &exec.Cmd{
+		Path: cmd.Path,
+		Args: slices.Clone(cmd.Args),
+		Env:  slices.Clone(cmd.Env),
+		Dir:  cmd.Dir,
+		Err:  cmd.Err,
+	}
+}
+
+// isSuccessExitCode reports whether the exit code is considered successful for
+// the command.
+func (c *Command) isSuccessExitCode(code int) bool {
+	if len(c.successCodes) == 0 {
+		return code == 0
+	}
+	return slices.Contains(c.successCodes, code)
+}
+
 // CommandLine returns the set or generated command line of the command.
-func (c Command) CommandLine() string {
+func (c *Command) CommandLine() string {
 	return c.cmdline
 }
 
 // ProcessState returns the exit state of the command, if the command was
 // successfully started and waited for.
-func (c Command) ProcessState() *os.ProcessState {
+func (c *Command) ProcessState() *os.ProcessState {
 	return c.cmd.ProcessState
 }
 
-// Err returns the error from running the command (including non-zero exit).
-func (c Command) Err() error {
+// Ready reports whether the command is ready, i.e. one of its readiness probes
+// (see [WithReadyWhen]) has succeeded. A command without readiness probes is
+// ready as soon as it is started.
+func (c *Command) Ready() bool {
+	return c.ready.Load()
+}
+
+// Cancelled reports whether the command was terminated because another command
+// failed in fail-fast mode (see [WithFailFast]).
+func (c *Command) Cancelled() bool {
+	return c.cancelled
+}
+
+// StartTime returns the time the command was started, or the zero time if it
+// wasn't.
+func (c *Command) StartTime() time.Time {
+	return c.startTime
+}
+
+// EndTime returns the time the command was done, including if it failed to
+// start, or the zero time if it wasn't started or is still running.
+func (c *Command) EndTime() time.Time {
+	return c.endTime
+}
+
+// Duration returns the running duration of the command: from StartTime to
+// EndTime, until now if it's still running, or 0 if it wasn't started.
+func (c *Command) Duration() time.Duration {
+	if c.startTime.IsZero() {
+		return 0
+	}
+	if c.endTime.IsZero() {
+		return time.Since(c.startTime)
+	}
+	return c.endTime.Sub(c.startTime)
+}
+
+// Err returns the error from running the command (including non-zero exit,
+// unless the exit code is declared successful with [WithSuccessExitCodes]).
+func (c *Command) Err() error {
 	return c.err
 }
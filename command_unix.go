@@ -8,5 +8,7 @@ import "os/exec"
 //	NewCommand(exec.Command("sh", "-c", cmdline), append([]CommandOption{WithCommandLine(cmdline)}, opts...)...)
 func NewCommandWithShell(cmdline string, opts ...CommandOption) *Command {
 	opts = append([]CommandOption{WithCommandLine(cmdline)}, opts...)
-	return NewCommand(exec.Command("sh", "-c", cmdline), opts...)
+	c := NewCommand(exec.Command("sh", "-c", cmdline), opts...)
+	c.shell = true
+	return c
 }
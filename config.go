@@ -0,0 +1,523 @@
+package mrun
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"gopkg.in/yaml.v3"
+)
+
+// LoadConfig loads commands and run options from a YAML config file, which
+// looks like:
+//
+//	columns: 2          # WithColumns
+//	command_lines: true # WithCommandLines
+//	auto_quit: false    # WithAutoQuit
+//	final_view: true    # WithFinalView
+//	fail_fast: false    # WithFailFast
+//	timestamps: elapsed # WithTimestamps
+//	highlight:          # WithHighlight; patterns to ANSI or hex colors.
+//	  "ERROR|FAIL|panic:": "196"
+//	  WARN: "#ffd700"
+//	theme: light        # WithTheme; dark, light, high-contrast or no-color.
+//	border: rounded     # WithBorder; minimal, normal, rounded, double or thick.
+//	no_wrap: false      # WithNoWrap
+//	forward_bell: true  # WithBellForwarding
+//	help_footer: true   # WithHelpFooter
+//	commands:
+//	  - run: npm run dev # Command line run with sh, or
+//	    label: web
+//	    dir: web         # Relative to the directory of the config file,
+//	                     # unless it starts with a ${VAR} reference.
+//	    env:
+//	      PORT: "3000"
+//	    env_file: web.env # Relative to the directory of the config file.
+//	    clean_env: false
+//	    env_unset: [GOFLAGS]
+//	    env_passthrough: [PATH, "GO*"]
+//	  - argv: [go, run, ./api] # argv run directly.
+//	    expand_vars: true # WithExpandVars
+//	    cmdline: api server
+//	    ready:           # WithReadyWhen; any of output, port and file.
+//	      output: listening on
+//	    success_codes: [0, 1]
+//	    allow_failure: true
+//	    timestamps: "15:04:05"
+//	    filter: "^(GET|POST)" # WithFilter
+//	    invert_filter: true
+//	    no_wrap: true    # WithCommandNoWrap
+//	    stall_warning: 2m # WithStallWarning
+//	    stall_timeout: 10m # WithStallTimeout
+//	    progress: true   # WithProgress(ParseProgress)
+//	    highlight:       # WithCommandHighlight
+//	      "^GET": "2"
+//
+// Each command must have exactly one of run and argv. Errors point to the
+// offending line of the file.
+func LoadConfig(path string) ([]*Command, []RunOption, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	l := configLoader{path: path, dir: filepath.Dir(path)}
+	if len(doc.Content) == 0 {
+		return nil, nil, l.errorf(&doc, "empty config")
+	}
+	return l.loadRoot(doc.Content[0])
+}
+
+type configLoader struct {
+	path string
+	// Directory of the config file, for resolving relative dirs.
+	dir string
+}
+
+func (l configLoader) errorf(node *yaml.Node, format string, a ...any) error {
+	return fmt.Errorf("%s:%d: %s", l.path, node.Line, fmt.Sprintf(format, a...))
+}
+
+// decode decodes a node into v, annotating errors with the line number.
+func (l configLoader) decode(node *yaml.Node, key string, v any) error {
+	if err := node.Decode(v); err != nil {
+		return l.errorf(node, "invalid %s: expected %s", key, configTypeName(v))
+	}
+	return nil
+}
+
+func configTypeName(v any) string {
+	switch v.(type) {
+	case *bool:
+		return "boolean"
+	case *int:
+		return "integer"
+	case *string:
+		return "string"
+	case *[]string:
+		return "list of strings"
+	case *[]int:
+		return "list of integers"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+// forEachKey calls fn on each key-value pair of a mapping node.
+func (l configLoader) forEachKey(node *yaml.Node, what string, fn func(key string, keyNode, value *yaml.Node) error) error {
+	if node.Kind != yaml.MappingNode {
+		return l.errorf(node, "%s must be a mapping", what)
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		keyNode, value := node.Content[i], node.Content[i+1]
+		if err := fn(keyNode.Value, keyNode, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l configLoader) loadRoot(node *yaml.Node) ([]*Command, []RunOption, error) {
+	var commands []*Command
+	var opts []RunOption
+	var commandsNode *yaml.Node
+	err := l.forEachKey(node, "config", func(key string, keyNode, value *yaml.Node) error {
+		var b bool
+		switch key {
+		case "columns":
+			var cols int
+			if err := l.decode(value, key, &cols); err != nil {
+				return err
+			}
+			if cols <= 0 {
+				return l.errorf(value, "columns must be positive")
+			}
+			opts = append(opts, WithColumns(cols))
+		case "command_lines", "auto_quit", "final_view", "fail_fast", "no_wrap", "forward_bell", "help_footer":
+			if err := l.decode(value, key, &b); err != nil {
+				return err
+			}
+			if !b {
+				return nil
+			}
+			switch key {
+			case "command_lines":
+				opts = append(opts, WithCommandLines())
+			case "auto_quit":
+				opts = append(opts, WithAutoQuit())
+			case "final_view":
+				opts = append(opts, WithFinalView())
+			case "fail_fast":
+				opts = append(opts, WithFailFast())
+			case "no_wrap":
+				opts = append(opts, WithNoWrap())
+			case "forward_bell":
+				opts = append(opts, WithBellForwarding())
+			case "help_footer":
+				opts = append(opts, WithHelpFooter())
+			}
+		case "timestamps":
+			var format string
+			if err := l.decode(value, key, &format); err != nil {
+				return err
+			}
+			opts = append(opts, WithTimestamps(format))
+		case "highlight":
+			highlights, err := l.loadHighlight(value)
+			if err != nil {
+				return err
+			}
+			for _, h := range highlights {
+				opts = append(opts, WithHighlight(h.pattern, h.style))
+			}
+		case "theme":
+			var name string
+			if err := l.decode(value, key, &name); err != nil {
+				return err
+			}
+			theme, ok := map[string]func() Theme{
+				"dark":          DarkTheme,
+				"light":         LightTheme,
+				"high-contrast": HighContrastTheme,
+				"no-color":      NoColorTheme,
+			}[name]
+			if !ok {
+				return l.errorf(value, "unknown theme %q", name)
+			}
+			opts = append(opts, WithTheme(theme()))
+		case "border":
+			var name string
+			if err := l.decode(value, key, &name); err != nil {
+				return err
+			}
+			border, ok := map[string]PaneBorder{
+				"minimal": BorderMinimal,
+				"normal":  BorderNormal,
+				"rounded": BorderRounded,
+				"double":  BorderDouble,
+				"thick":   BorderThick,
+			}[name]
+			if !ok {
+				return l.errorf(value, "unknown border %q", name)
+			}
+			opts = append(opts, WithBorder(border))
+		case "commands":
+			if value.Kind != yaml.SequenceNode {
+				return l.errorf(value, "commands must be a list")
+			}
+			commandsNode = value
+			for _, item := range value.Content {
+				c, err := l.loadCommand(item)
+				if err != nil {
+					return err
+				}
+				commands = append(commands, c)
+			}
+		default:
+			return l.errorf(keyNode, "unknown key %q", key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(commands) == 0 {
+		if commandsNode != nil {
+			return nil, nil, l.errorf(commandsNode, "commands must not be empty")
+		}
+		return nil, nil, l.errorf(node, "missing commands")
+	}
+	return commands, opts, nil
+}
+
+func (l configLoader) loadCommand(node *yaml.Node) (*Command, error) {
+	var (
+		run     string
+		argv    []string
+		hasRun  bool
+		hasArgv bool
+		opts    []CommandOption
+		filter  *regexp.Regexp
+		invert  bool
+	)
+	err := l.forEachKey(node, "command", func(key string, keyNode, value *yaml.Node) error {
+		switch key {
+		case "run":
+			hasRun = true
+			if err := l.decode(value, key, &run); err != nil {
+				return err
+			}
+			if strings.TrimSpace(run) == "" {
+				return l.errorf(value, "run must not be empty")
+			}
+		case "argv":
+			hasArgv = true
+			if err := l.decode(value, key, &argv); err != nil {
+				return err
+			}
+			if len(argv) == 0 {
+				return l.errorf(value, "argv must not be empty")
+			}
+		case "label":
+			var label string
+			if err := l.decode(value, key, &label); err != nil {
+				return err
+			}
+			opts = append(opts, WithLabel(label))
+		case "cmdline":
+			var cmdline string
+			if err := l.decode(value, key, &cmdline); err != nil {
+				return err
+			}
+			opts = append(opts, WithCommandLine(cmdline))
+		case "dir":
+			var dir string
+			if err := l.decode(value, key, &dir); err != nil {
+				return err
+			}
+			// ${VAR} references are expanded when the command is started, so
+			// a dir starting with one may well be absolute.
+			if !filepath.IsAbs(dir) && !strings.HasPrefix(dir, "${") {
+				dir = filepath.Join(l.dir, dir)
+			}
+			opts = append(opts, WithDir(dir))
+		case "env":
+			env, err := l.loadEnv(value)
+			if err != nil {
+				return err
+			}
+			opts = append(opts, WithEnv(env))
+		case "env_file":
+			var file string
+			if err := l.decode(value, key, &file); err != nil {
+				return err
+			}
+			if !filepath.IsAbs(file) {
+				file = filepath.Join(l.dir, file)
+			}
+			opts = append(opts, WithEnvFile(file))
+		case "expand_vars":
+			var b bool
+			if err := l.decode(value, key, &b); err != nil {
+				return err
+			}
+			if b {
+				opts = append(opts, WithExpandVars())
+			}
+		case "clean_env":
+			var b bool
+			if err := l.decode(value, key, &b); err != nil {
+				return err
+			}
+			if b {
+				opts = append(opts, WithCleanEnv())
+			}
+		case "env_unset":
+			var keys []string
+			if err := l.decode(value, key, &keys); err != nil {
+				return err
+			}
+			opts = append(opts, WithEnvUnset(keys...))
+		case "env_passthrough":
+			var patterns []string
+			if err := l.decode(value, key, &patterns); err != nil {
+				return err
+			}
+			for _, pattern := range patterns {
+				if _, err := path.Match(pattern, ""); err != nil {
+					return l.errorf(value, "invalid env_passthrough pattern %q", pattern)
+				}
+			}
+			opts = append(opts, WithEnvPassthrough(patterns...))
+		case "ready":
+			probes, err := l.loadReady(value)
+			if err != nil {
+				return err
+			}
+			opts = append(opts, WithReadyWhen(probes...))
+		case "success_codes":
+			var codes []int
+			if err := l.decode(value, key, &codes); err != nil {
+				return err
+			}
+			opts = append(opts, WithSuccessExitCodes(codes...))
+		case "allow_failure":
+			var b bool
+			if err := l.decode(value, key, &b); err != nil {
+				return err
+			}
+			if b {
+				opts = append(opts, WithAllowFailure())
+			}
+		case "timestamps":
+			var format string
+			if err := l.decode(value, key, &format); err != nil {
+				return err
+			}
+			opts = append(opts, WithCommandTimestamps(format))
+		case "stall_warning", "stall_timeout":
+			var s string
+			if err := l.decode(value, key, &s); err != nil {
+				return err
+			}
+			d, err := time.ParseDuration(s)
+			if err != nil || d <= 0 {
+				return l.errorf(value, "%s must be a positive duration like 2m", key)
+			}
+			if key == "stall_warning" {
+				opts = append(opts, WithStallWarning(d))
+			} else {
+				opts = append(opts, WithStallTimeout(d))
+			}
+		case "filter":
+			var pattern string
+			if err := l.decode(value, key, &pattern); err != nil {
+				return err
+			}
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return l.errorf(value, "invalid filter pattern: %s", err)
+			}
+			filter = re
+		case "highlight":
+			highlights, err := l.loadHighlight(value)
+			if err != nil {
+				return err
+			}
+			for _, h := range highlights {
+				opts = append(opts, WithCommandHighlight(h.pattern, h.style))
+			}
+		case "invert_filter":
+			if err := l.decode(value, key, &invert); err != nil {
+				return err
+			}
+		case "no_wrap":
+			var b bool
+			if err := l.decode(value, key, &b); err != nil {
+				return err
+			}
+			if b {
+				opts = append(opts, WithCommandNoWrap())
+			}
+		case "progress":
+			var b bool
+			if err := l.decode(value, key, &b); err != nil {
+				return err
+			}
+			if b {
+				opts = append(opts, WithProgress(nil))
+			}
+		default:
+			return l.errorf(keyNode, "unknown command key %q", key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if filter != nil {
+		opts = append(opts, WithFilter(filter, invert))
+	}
+	switch {
+	case hasRun && hasArgv:
+		return nil, l.errorf(node, "command must not have both run and argv")
+	case hasRun:
+		return NewCommandWithShell(run, opts...), nil
+	case hasArgv:
+		return NewCommand(exec.Command(argv[0], argv[1:]...), opts...), nil
+	default:
+		return nil, l.errorf(node, "command must have either run or argv")
+	}
+}
+
+// loadEnv loads environment variables from either a mapping of names to values
+// or a list of KEY=VALUE strings.
+func (l configLoader) loadEnv(node *yaml.Node) ([]string, error) {
+	var env []string
+	if node.Kind == yaml.SequenceNode {
+		for _, item := range node.Content {
+			var kv string
+			if err := l.decode(item, "env", &kv); err != nil {
+				return nil, err
+			}
+			if !strings.Contains(kv, "=") {
+				return nil, l.errorf(item, "env entry must be in the form KEY=VALUE")
+			}
+			env = append(env, kv)
+		}
+		return env, nil
+	}
+	err := l.forEachKey(node, "env", func(key string, keyNode, value *yaml.Node) error {
+		var v string
+		if err := l.decode(value, "env value", &v); err != nil {
+			return err
+		}
+		env = append(env, key+"="+v)
+		return nil
+	})
+	return env, err
+}
+
+func (l configLoader) loadReady(node *yaml.Node) ([]ReadyProbe, error) {
+	var probes []ReadyProbe
+	err := l.forEachKey(node, "ready", func(key string, keyNode, value *yaml.Node) error {
+		switch key {
+		case "output":
+			var pattern string
+			if err := l.decode(value, key, &pattern); err != nil {
+				return err
+			}
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return l.errorf(value, "invalid output pattern: %s", err)
+			}
+			probes = append(probes, ReadyOnOutput(re))
+		case "port":
+			var port int
+			if err := l.decode(value, key, &port); err != nil {
+				return err
+			}
+			if port <= 0 || port > 65535 {
+				return l.errorf(value, "invalid port %d", port)
+			}
+			probes = append(probes, ReadyOnPort(port))
+		case "file":
+			var path string
+			if err := l.decode(value, key, &path); err != nil {
+				return err
+			}
+			probes = append(probes, ReadyOnFile(path))
+		default:
+			return l.errorf(keyNode, "unknown ready key %q", key)
+		}
+		return nil
+	})
+	return probes, err
+}
+
+// loadHighlight loads highlight rules from a mapping of patterns to colors.
+func (l configLoader) loadHighlight(node *yaml.Node) ([]highlight, error) {
+	var highlights []highlight
+	err := l.forEachKey(node, "highlight", func(key string, keyNode, value *yaml.Node) error {
+		re, err := regexp.Compile(key)
+		if err != nil {
+			return l.errorf(keyNode, "invalid highlight pattern: %s", err)
+		}
+		var color string
+		if err := l.decode(value, "highlight color", &color); err != nil {
+			return err
+		}
+		highlights = append(highlights, highlight{re, lipgloss.NewStyle().Foreground(lipgloss.Color(color))})
+		return nil
+	})
+	return highlights, err
+}
@@ -0,0 +1,148 @@
+package mrun
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// writeConfig writes a config file to a temporary directory and returns its
+// path.
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "mrun.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		// Expected error after the path of the config file.
+		err string
+	}{
+		{"empty", "", ":0: empty config"},
+		{"not a mapping", "- run: x\n", ":1: config must be a mapping"},
+		{"missing commands", "columns: 2\n", ":1: missing commands"},
+		{"empty commands", "commands: []\n", ":1: commands must not be empty"},
+		{"commands not a list", "commands: x\n", ":1: commands must be a list"},
+		{"unknown key", "commands:\n  - run: x\nfoo: 1\n", `:3: unknown key "foo"`},
+		{"invalid type", "columns: two\ncommands:\n  - run: x\n", ":1: invalid columns: expected integer"},
+		{"non-positive columns", "columns: 0\ncommands:\n  - run: x\n", ":1: columns must be positive"},
+		{"invalid boolean", "auto_quit: maybe\ncommands:\n  - run: x\n", ":1: invalid auto_quit: expected boolean"},
+		{"unknown theme", "theme: neon\ncommands:\n  - run: x\n", `:1: unknown theme "neon"`},
+		{"unknown border", "border: dotted\ncommands:\n  - run: x\n", `:1: unknown border "dotted"`},
+		{"invalid highlight", "highlight:\n  \"(\": \"1\"\ncommands:\n  - run: x\n", ":2: invalid highlight pattern:"},
+		{"command not a mapping", "commands:\n  - x\n", ":2: command must be a mapping"},
+		{"unknown command key", "commands:\n  - run: x\n    bogus: 1\n", `:3: unknown command key "bogus"`},
+		{"run and argv", "commands:\n  - run: x\n    argv: [y]\n", ":2: command must not have both run and argv"},
+		{"neither run nor argv", "commands:\n  - run: x\n  - label: y\n", ":3: command must have either run or argv"},
+		{"empty run", "commands:\n  - run: \" \"\n", ":2: run must not be empty"},
+		{"empty argv", "commands:\n  - argv: []\n", ":2: argv must not be empty"},
+		{"invalid argv", "commands:\n  - argv: x\n", ":2: invalid argv: expected list of strings"},
+		{"invalid env entry", "commands:\n  - run: x\n    env: [FOO]\n", ":3: env entry must be in the form KEY=VALUE"},
+		{"invalid env value", "commands:\n  - run: x\n    env:\n      FOO: [1]\n", ":4: invalid env value: expected string"},
+		{"invalid filter", "commands:\n  - run: x\n    filter: \"(\"\n", ":3: invalid filter pattern:"},
+		{"invalid port", "commands:\n  - run: x\n    ready:\n      port: 70000\n", ":4: invalid port 70000"},
+		{"unknown ready key", "commands:\n  - run: x\n    ready:\n      socket: x\n", `:4: unknown ready key "socket"`},
+		{"invalid duration", "commands:\n  - run: x\n    stall_warning: soon\n", ":3: stall_warning must be a positive duration like 2m"},
+		{"negative duration", "commands:\n  - run: x\n    stall_timeout: -1m\n", ":3: stall_timeout must be a positive duration like 2m"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeConfig(t, tt.config)
+			_, _, err := LoadConfig(path)
+			if err == nil {
+				t.Fatalf("LoadConfig() succeeded, want error %q", tt.err)
+			}
+			if !strings.HasPrefix(err.Error(), path+tt.err) {
+				t.Errorf("LoadConfig() error = %q, want %q", err, path+tt.err)
+			}
+		})
+	}
+}
+
+func TestLoadConfigYAMLError(t *testing.T) {
+	path := writeConfig(t, "commands: [\n")
+	_, _, err := LoadConfig(path)
+	if err == nil || !strings.HasPrefix(err.Error(), path+": yaml:") {
+		t.Errorf("LoadConfig() error = %v, want YAML error prefixed with the path", err)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := writeConfig(t, `columns: 2
+auto_quit: true
+commands:
+  - run: npm run dev
+    label: web
+    env:
+      PORT: "3000"
+  - argv: [go, run, ./api]
+    env: [DEBUG=1]
+    cmdline: api server
+`)
+	commands, opts, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(opts) != 2 {
+		t.Errorf("got %d run options, want 2", len(opts))
+	}
+	if len(commands) != 2 {
+		t.Fatalf("got %d commands, want 2", len(commands))
+	}
+	web, api := commands[0], commands[1]
+	if !web.shell || web.cmdline != "npm run dev" || web.label != "web" {
+		t.Errorf("web: shell = %v, cmdline = %q, label = %q", web.shell, web.cmdline, web.label)
+	}
+	if !slices.Equal(web.env, []string{"PORT=3000"}) {
+		t.Errorf("web: env = %q", web.env)
+	}
+	if api.shell || !slices.Equal(api.cmd.Args, []string{"go", "run", "./api"}) || api.cmdline != "api server" {
+		t.Errorf("api: shell = %v, args = %q, cmdline = %q", api.shell, api.cmd.Args, api.cmdline)
+	}
+	if !slices.Equal(api.env, []string{"DEBUG=1"}) {
+		t.Errorf("api: env = %q", api.env)
+	}
+}
+
+func TestLoadConfigPaths(t *testing.T) {
+	path := writeConfig(t, `commands:
+  - run: x
+    dir: web
+    env_file: web.env
+  - run: x
+    dir: /srv/api
+    env_file: /etc/api.env
+  - run: x
+    dir: ${HOME}/src
+`)
+	dir := filepath.Dir(path)
+	commands, _, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		dir      string
+		envFiles []string
+	}{
+		{filepath.Join(dir, "web"), []string{filepath.Join(dir, "web.env")}},
+		{"/srv/api", []string{"/etc/api.env"}},
+		{"${HOME}/src", nil},
+	}
+	for i, tt := range tests {
+		c := commands[i]
+		if c.cmd.Dir != tt.dir {
+			t.Errorf("command %d: dir = %q, want %q", i, c.cmd.Dir, tt.dir)
+		}
+		if !slices.Equal(c.envFiles, tt.envFiles) {
+			t.Errorf("command %d: env files = %q, want %q", i, c.envFiles, tt.envFiles)
+		}
+	}
+}
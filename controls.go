@@ -0,0 +1,115 @@
+package mrun
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Clickable controls in the bottom border of panes.
+const (
+	_restartControl = "restart"
+	_zoomControl    = "zoom"
+	_stopControl    = "stop"
+)
+
+// running reports whether the command of the pane has been started and is not
+// done yet.
+func (p *modelPane) running() bool {
+	return p.started && !p.exited && !p.errored && !p.stopped
+}
+
+// controlsView renders the clickable controls of pane idx: restart, zoom, and
+// stop while the command is running.
+func (m model) controlsView(idx int, style func(string) string) string {
+	zoom := "⤢"
+	if m.zoomed {
+		zoom = "⤡"
+	}
+	controls := []string{
+		m.grid.mark(m.controlId(idx, _restartControl), style("↻")),
+		m.grid.mark(m.controlId(idx, _zoomControl), style(zoom)),
+	}
+	if m.panes[idx].running() {
+		controls = append(controls, m.grid.mark(m.controlId(idx, _stopControl), style("■")))
+	}
+	return style(" ") + strings.Join(controls, style(" ")) + style(" ")
+}
+
+// clickedControl returns the control of pane idx clicked by the mouse event, if
+// any.
+func (m model) clickedControl(idx int, msg tea.MouseMsg) string {
+	for _, control := range []string{_restartControl, _zoomControl, _stopControl} {
+		if m.grid.inBounds(m.controlId(idx, control), msg) {
+			return control
+		}
+	}
+	return ""
+}
+
+// stopPane gracefully terminates the command of pane idx, keeping the pane.
+func (m *model) stopPane(idx int) tea.Cmd {
+	pane := &m.panes[idx]
+	if m.terminating || !pane.running() || pane.stopping || pane.restarting {
+		return nil
+	}
+	pane.stopping = true
+	return m.executor.stop(pane.cmd, false)
+}
+
+// restartPane stops the command of pane idx if it's still running, then runs
+// it again in the pane once it's done (see restartedPane).
+func (m *model) restartPane(idx int) tea.Cmd {
+	pane := &m.panes[idx]
+	if m.terminating || !pane.started || pane.restarting {
+		return nil
+	}
+	pane.restarting = true
+	return m.executor.stop(pane.cmd, true)
+}
+
+// restartedPane runs the command of pane idx again after it has been stopped
+// for a restart, clearing the output of the pane. Filter and timestamps toggled
+// at runtime are kept.
+func (m *model) restartedPane(idx int) tea.Cmd {
+	old := &m.panes[idx]
+	m.executor.remove(old.cmd)
+	old.cmd.reset()
+	pane := m.newPane(old.cmd)
+	pane.showTimestamps = old.showTimestamps
+	pane.filter = old.filter
+	pane.filterInvert = old.filterInvert
+	pane.vw, pane.vh = old.vw, old.vh
+	pane.v = old.v
+	pane.started = true
+	var cmd tea.Cmd
+	pane.winsizeCh, cmd = m.executor.runCommand(pane.cmd, pane.vw, pane.vh)
+	pane.refreshContent()
+	pane.v.GotoBottom()
+	m.panes[idx] = pane
+
+	cmds := []tea.Cmd{cmd}
+	if m.allDone {
+		m.allDone = false
+		m.dialogActive = false
+	}
+	if !m.waitingForAllDone {
+		cmds = append(cmds, m.waitForAllDone())
+	}
+	cmds = append(cmds, m.startTicking())
+	return tea.Batch(cmds...)
+}
+
+// toggleZoom toggles between the grid and showing the active pane only.
+func (m *model) toggleZoom() tea.Cmd {
+	if m.count == 0 {
+		return nil
+	}
+	m.zoomed = !m.zoomed
+	return m.layout()
+}
+
+func (m model) controlId(idx int, control string) string {
+	return m.id + fmt.Sprintf("%s%d", control, idx)
+}
@@ -0,0 +1,280 @@
+package mrun
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/muesli/termenv"
+)
+
+type selectionKind int
+
+const (
+	selectionNone selectionKind = iota
+	// Characters from the anchor to the cursor, like vim's v.
+	selectionStream
+	// Whole rows from the anchor to the cursor, like vim's V.
+	selectionLine
+	// Rectangle spanned by the anchor and the cursor, like vim's ctrl+v.
+	selectionBlock
+)
+
+// copyMode is the vim-like copy mode state of a pane, in which a cursor is
+// moved over the rendered rows of the pane to select and yank text.
+type copyMode struct {
+	active bool
+	// Cursor position, in runes of the ANSI-stripped rows.
+	row, col  int
+	selection selectionKind
+	// Position where the selection was started.
+	anchorRow, anchorCol int
+}
+
+// enterCopyMode activates copy mode with the cursor on the last visible row.
+func (p *modelPane) enterCopyMode() {
+	p.copy = copyMode{
+		active: true,
+		row:    min(p.v.YOffset+p.v.Height-1, len(p.rows)-1),
+	}
+	p.setContent()
+}
+
+func (p *modelPane) exitCopyMode() {
+	p.copy = copyMode{}
+	p.setContent()
+}
+
+// plainRow returns the ANSI-stripped runes of a row.
+func (p *modelPane) plainRow(row int) []rune {
+	if row < 0 || row >= len(p.rows) {
+		return nil
+	}
+	return []rune(ansi.Strip(p.rows[row]))
+}
+
+// updateCopyMode handles a key in copy mode. It returns the text to be yanked
+// to the clipboard, if any.
+func (p *modelPane) updateCopyMode(km KeyMap, msg tea.KeyMsg) (yanked string, ok bool) {
+	c := &p.copy
+	selectKinds := []struct {
+		binding key.Binding
+		kind    selectionKind
+	}{
+		{km.SelectStream, selectionStream},
+		{km.SelectLine, selectionLine},
+		{km.SelectBlock, selectionBlock},
+	}
+	switch {
+	case key.Matches(msg, km.CopyDown):
+		c.row++
+	case key.Matches(msg, km.CopyUp):
+		c.row--
+	case key.Matches(msg, km.CopyLeft):
+		c.col--
+	case key.Matches(msg, km.CopyRight):
+		c.col++
+	case key.Matches(msg, km.CopyLineStart):
+		c.col = 0
+	case key.Matches(msg, km.CopyLineEnd):
+		c.col = len(p.plainRow(c.row)) - 1
+	case key.Matches(msg, km.CopyTop):
+		c.row = 0
+	case key.Matches(msg, km.CopyBottom):
+		c.row = len(p.rows) - 1
+	case key.Matches(msg, km.CopyHalfPageUp):
+		c.row -= p.v.Height / 2
+	case key.Matches(msg, km.CopyHalfPageDown):
+		c.row += p.v.Height / 2
+	case key.Matches(msg, km.CopyPageUp):
+		c.row -= p.v.Height
+	case key.Matches(msg, km.CopyPageDown):
+		c.row += p.v.Height
+	case key.Matches(msg, km.SelectStream, km.SelectLine, km.SelectBlock):
+		var kind selectionKind
+		for _, k := range selectKinds {
+			if key.Matches(msg, k.binding) {
+				kind = k.kind
+				break
+			}
+		}
+		if c.selection == kind {
+			c.selection = selectionNone
+		} else {
+			if c.selection == selectionNone {
+				c.anchorRow, c.anchorCol = c.row, c.col
+			}
+			c.selection = kind
+		}
+	case key.Matches(msg, km.Yank):
+		yanked = p.selectedText()
+		p.exitCopyMode()
+		return yanked, true
+	case key.Matches(msg, km.CopyCancel):
+		if c.selection != selectionNone {
+			c.selection = selectionNone
+		} else {
+			p.exitCopyMode()
+			return "", false
+		}
+	}
+	p.clampCopyCursor()
+	p.scrollToCopyCursor()
+	p.setContent()
+	// Keep the cursor visible.
+	if c.row < p.v.YOffset {
+		p.v.SetYOffset(c.row)
+	} else if c.row >= p.v.YOffset+p.v.Height {
+		p.v.SetYOffset(c.row - p.v.Height + 1)
+	}
+	return "", false
+}
+
+func (p *modelPane) clampCopyCursor() {
+	c := &p.copy
+	c.row = clamp(c.row, 0, max(len(p.rows)-1, 0))
+	c.col = clamp(c.col, 0, max(len(p.plainRow(c.row))-1, 0))
+	c.anchorRow = clamp(c.anchorRow, 0, max(len(p.rows)-1, 0))
+}
+
+// selectionBounds returns the normalized selection: start and end rows, and
+// start and end columns, whose meaning depends on the selection kind.
+func (c copyMode) selectionBounds() (r1, c1, r2, c2 int) {
+	r1, c1, r2, c2 = c.anchorRow, c.anchorCol, c.row, c.col
+	switch c.selection {
+	case selectionStream:
+		if r1 > r2 || (r1 == r2 && c1 > c2) {
+			r1, c1, r2, c2 = r2, c2, r1, c1
+		}
+	case selectionBlock:
+		r1, r2 = min(r1, r2), max(r1, r2)
+		c1, c2 = min(c1, c2), max(c1, c2)
+	default:
+		r1, r2 = min(r1, r2), max(r1, r2)
+	}
+	return
+}
+
+// selectedColumns returns the range [from, to) of columns of a row covered by
+// the selection, or ok == false if the row is not selected.
+func (c copyMode) selectedColumns(row, rowLen int) (from, to int, ok bool) {
+	if c.selection == selectionNone {
+		return 0, 0, false
+	}
+	r1, c1, r2, c2 := c.selectionBounds()
+	if row < r1 || row > r2 {
+		return 0, 0, false
+	}
+	switch c.selection {
+	case selectionStream:
+		from, to = 0, rowLen
+		if row == r1 {
+			from = c1
+		}
+		if row == r2 {
+			to = c2 + 1
+		}
+	case selectionLine:
+		from, to = 0, rowLen
+	case selectionBlock:
+		from, to = c1, c2+1
+	}
+	return from, to, true
+}
+
+// selectedText returns the ANSI-stripped text of the selection, or of the
+// cursor row if nothing is selected. Rows wrapped from the same line are joined
+// except in block selections. The command line header and the timestamps gutter
+// are left out.
+func (p *modelPane) selectedText() string {
+	c := p.copy
+	if c.selection == selectionNone {
+		c.selection = selectionLine
+		c.anchorRow = c.row
+	}
+	r1, _, r2, _ := c.selectionBounds()
+	r1 = max(r1, p.headerRows)
+	var b strings.Builder
+	for row := r1; row <= r2; row++ {
+		runes := p.plainRow(row)
+		from, to, _ := c.selectedColumns(row, len(runes))
+		from = max(from, p.gutterWidth)
+		from, to = min(from, len(runes)), min(to, len(runes))
+		to = max(to, from)
+		if row > r1 && (c.selection == selectionBlock || !p.rowJoins[row]) {
+			b.WriteByte('\n')
+		}
+		text := string(runes[from:to])
+		if row == r2 || c.selection == selectionBlock || !p.rowJoins[row+1] {
+			text = strings.TrimRight(text, " ")
+		}
+		b.WriteString(text)
+	}
+	return b.String()
+}
+
+// copyModeContent renders the rows with the cursor and selection. Rows with
+// the cursor or a selection are rendered without their original styling.
+func (p *modelPane) copyModeContent() string {
+	c := p.copy
+	r1, _, r2, _ := c.selectionBounds()
+	rows := make([]string, len(p.rows))
+	for row, rendered := range p.rows {
+		inSelection := c.selection != selectionNone && row >= r1 && row <= r2
+		if !inSelection && row != c.row {
+			rows[row] = rendered
+			continue
+		}
+		runes := p.plainRow(row)
+		from, to, selected := c.selectedColumns(row, len(runes))
+		// Pad the row so that the cursor and the selection are visible past
+		// the end of the text.
+		width := len(runes)
+		if selected {
+			width = max(width, to)
+		}
+		if row == c.row {
+			width = max(width, c.col+1)
+		}
+		for len(runes) < width {
+			runes = append(runes, ' ')
+		}
+		if !selected {
+			from, to = 0, 0
+		}
+		// Render runs of plain, selected and cursor runes.
+		var b strings.Builder
+		for i := 0; i < len(runes); {
+			style := p.styles.renderer.NewStyle()
+			j := i + 1
+			switch {
+			case row == c.row && i == c.col:
+				style = p.styles.copyCursor
+			case i >= from && i < to:
+				style = p.styles.copySelection
+				for j < to && !(row == c.row && j == c.col) {
+					j++
+				}
+			default:
+				for j < len(runes) && j != from && !(row == c.row && j == c.col) {
+					j++
+				}
+			}
+			b.WriteString(style.Render(string(runes[i:j])))
+			i = j
+		}
+		rows[row] = b.String()
+	}
+	return strings.Join(rows, "\n")
+}
+
+// copyToClipboard returns a command that copies text to the system clipboard
+// with the OSC 52 escape sequence.
+func copyToClipboard(out *terminalOutput, text string) tea.Cmd {
+	return func() tea.Msg {
+		termenv.NewOutput(out).Copy(text)
+		return feedbackMsg{fmt.Sprintf("Copied %d characters to clipboard.", len([]rune(text)))}
+	}
+}
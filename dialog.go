@@ -1,6 +1,10 @@
 package mrun
 
 import (
+	"fmt"
+	"time"
+
+	"github.com/charmbracelet/bubbles/key"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 )
@@ -8,21 +12,8 @@ import (
 var (
 	_dialogWidth = 40
 
-	_dialogPromptColor     = lipgloss.Color("255") // Grey93
-	_dialogBgColor         = lipgloss.Color("56")  // Purple3
-	_buttonTextColor       = lipgloss.Color("255") // Grey93
-	_activeButtonBgColor   = lipgloss.Color("168") // HotPink3
-	_inactiveButtonBgColor = lipgloss.Color("246") // Grey58
-
-	_dialogBoxStyle    = lipgloss.NewStyle().Padding(1).Background(_dialogBgColor)
-	_dialogPromptStyle = lipgloss.NewStyle().
-				Width(_dialogWidth - 2).Align(lipgloss.Center).
-				Foreground(_dialogPromptColor).Background(_dialogBgColor)
-
-	_buttonStyle         = lipgloss.NewStyle().Padding(0, 1).Foreground(_buttonTextColor)
-	_activeButtonStyle   = _buttonStyle.Background(_activeButtonBgColor)
-	_inactiveButtonStyle = _buttonStyle.Background(_inactiveButtonBgColor)
-	_buttonSpacerStyle   = lipgloss.NewStyle().Background(_dialogBgColor)
+	// How long a transient feedback dialog is shown.
+	_feedbackDuration = 2 * time.Second
 )
 
 type dialogButton struct {
@@ -31,13 +22,18 @@ type dialogButton struct {
 }
 
 type dialogModel struct {
+	keyMap KeyMap
+	styles *styles
+	// Layer the dialog is composited in, for clickable buttons.
+	layer    *layer
+	id       string
 	prompt   string
 	buttons  []dialogButton
 	selected int
 }
 
-func newDialogModel() dialogModel {
-	return dialogModel{}
+func newDialogModel(keyMap KeyMap, styles *styles, layer *layer) dialogModel {
+	return dialogModel{keyMap: keyMap, styles: styles, layer: layer, id: layer.zones.NewPrefix()}
 }
 
 func (m dialogModel) Init() tea.Cmd {
@@ -47,24 +43,36 @@ func (m dialogModel) Init() tea.Cmd {
 func (m dialogModel) Update(msg tea.Msg) (dialogModel, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
-		switch msg.String() {
-		case "tab":
+		km := m.keyMap
+		switch {
+		case key.Matches(msg, km.DialogNext):
 			m.selected = (m.selected + 1) % len(m.buttons)
-		case "shift+tab":
+		case key.Matches(msg, km.DialogPrev):
 			m.selected = (m.selected - 1 + len(m.buttons)) % len(m.buttons)
-		case "right":
+		case key.Matches(msg, km.DialogRight):
 			if m.selected < len(m.buttons)-1 {
 				m.selected++
 			}
-		case "left":
+		case key.Matches(msg, km.DialogLeft):
 			if m.selected > 0 {
 				m.selected--
 			}
-		case "enter":
+		case key.Matches(msg, km.DialogConfirm):
 			return m, m.buttons[m.selected].cmd
-		case "q", "esc":
+		case key.Matches(msg, km.DialogCancel):
 			return m, closeDialog()
 		}
+
+	case tea.MouseMsg:
+		if msg.Action != tea.MouseActionRelease || msg.Button != tea.MouseButtonLeft {
+			break
+		}
+		for i, b := range m.buttons {
+			if m.layer.inBounds(m.buttonId(i), msg) {
+				m.selected = i
+				return m, b.cmd
+			}
+		}
 	}
 	return m, nil
 }
@@ -73,24 +81,24 @@ func (m dialogModel) View() string {
 	if len(m.buttons) == 0 {
 		return ""
 	}
-	dialog := _dialogPromptStyle.Render(m.prompt)
+	dialog := m.styles.dialogPrompt.Render(m.prompt)
 	var renderedButtons []string
 	for i, b := range m.buttons {
-		style := _inactiveButtonStyle
+		style := m.styles.inactiveButton
 		if i == m.selected {
-			style = _activeButtonStyle
+			style = m.styles.activeButton
 		}
-		renderedButtons = append(renderedButtons, style.Render(b.text))
+		renderedButtons = append(renderedButtons, m.layer.mark(m.buttonId(i), style.Render(b.text)))
 		// Add a styled spacer; using margin will result in a spacer without proper background.
 		if i < len(m.buttons)-1 {
-			renderedButtons = append(renderedButtons, _buttonSpacerStyle.Render(" "))
+			renderedButtons = append(renderedButtons, m.styles.buttonSpacer.Render(" "))
 		}
 	}
 	buttons := lipgloss.JoinHorizontal(lipgloss.Top, renderedButtons...)
 	// Use PlaceHorizontal to make sure the entire button row is centered and
 	// has proper background.
-	buttons = lipgloss.PlaceHorizontal(_dialogWidth-2, lipgloss.Center, buttons, lipgloss.WithWhitespaceBackground(_dialogBgColor))
-	return _dialogBoxStyle.Render(lipgloss.JoinVertical(lipgloss.Center, dialog, "", buttons))
+	buttons = m.styles.renderer.PlaceHorizontal(_dialogWidth-2, lipgloss.Center, buttons, lipgloss.WithWhitespaceBackground(m.styles.dialogBg))
+	return m.styles.dialogBox.Render(lipgloss.JoinVertical(lipgloss.Center, dialog, "", buttons))
 }
 
 func (m *dialogModel) reset() {
@@ -99,6 +107,11 @@ func (m *dialogModel) reset() {
 	m.selected = 0
 }
 
-func dialogFeedbackView(text string) string {
-	return _dialogBoxStyle.Render(_dialogPromptStyle.Render(text))
+// feedbackView renders text in a dialog box without buttons.
+func (m dialogModel) feedbackView(text string) string {
+	return m.styles.dialogBox.Render(m.styles.dialogPrompt.Render(text))
+}
+
+func (m dialogModel) buttonId(i int) string {
+	return m.id + fmt.Sprintf("button%d", i)
 }
@@ -0,0 +1,184 @@
+package mrun
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var (
+	_dotenvKeyRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+	_varRefRegexp    = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+)
+
+// dedupEnv removes all but the last value of each variable in env, keeping the
+// order of the remaining entries.
+func dedupEnv(env []string) []string {
+	last := make(map[string]int)
+	for i, kv := range env {
+		key, _, _ := strings.Cut(kv, "=")
+		last[key] = i
+	}
+	// Never return nil, which would mean inheriting the current process's
+	// environment to exec.Cmd.
+	deduped := make([]string, 0, len(env))
+	for i, kv := range env {
+		key, _, _ := strings.Cut(kv, "=")
+		if last[key] == i {
+			deduped = append(deduped, kv)
+		}
+	}
+	return deduped
+}
+
+// substituteVars replaces ${VAR} references in s with values from vars, a list
+// of KEY=VALUE pairs. References to other variables are left alone.
+func substituteVars(s string, vars []string) string {
+	return _varRefRegexp.ReplaceAllStringFunc(s, func(ref string) string {
+		name := ref[2 : len(ref)-1]
+		for _, kv := range vars {
+			if k, v, ok := strings.Cut(kv, "="); ok && k == name {
+				return v
+			}
+		}
+		return ref
+	})
+}
+
+// expandVars expands ${VAR} references in s with values from env, a list of
+// KEY=VALUE pairs where later values take precedence. Other uses of $ are left
+// alone. It's an error to reference an undefined variable.
+func expandVars(s string, env []string) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+	var err error
+	expanded := _varRefRegexp.ReplaceAllStringFunc(s, func(ref string) string {
+		name := ref[2 : len(ref)-1]
+		for i := len(env) - 1; i >= 0; i-- {
+			if k, v, ok := strings.Cut(env[i], "="); ok && k == name {
+				return v
+			}
+		}
+		if err == nil {
+			err = fmt.Errorf("undefined variable %s in %q", name, s)
+		}
+		return ref
+	})
+	return expanded, err
+}
+
+// loadDotenv loads KEY=VALUE pairs from a dotenv file. See parseDotenv for
+// the syntax.
+func loadDotenv(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	env, err := parseDotenv(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%w", path, err)
+	}
+	return env, nil
+}
+
+// parseDotenv parses KEY=VALUE pairs in dotenv syntax:
+//
+//	# Comment
+//	KEY=value # Trailing comment
+//	export KEY=value
+//	KEY='literal value'
+//	KEY="value with \"escapes\"\n"
+//
+// Errors are prefixed with the line number followed by a colon.
+func parseDotenv(r io.Reader) ([]string, error) {
+	var env []string
+	scanner := bufio.NewScanner(r)
+	lineno := 0
+	for scanner.Scan() {
+		lineno++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || !_dotenvKeyRegexp.MatchString(key) {
+			return nil, fmt.Errorf("%d: invalid line, expected KEY=VALUE", lineno)
+		}
+		value, err := parseDotenvValue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("%d: %s", lineno, err)
+		}
+		env = append(env, key+"="+value)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+func parseDotenvValue(s string) (string, error) {
+	if s == "" {
+		return "", nil
+	}
+	switch quote := s[0]; quote {
+	case '\'':
+		end := strings.IndexByte(s[1:], '\'')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated quoted value")
+		}
+		if !isDotenvComment(s[end+2:]) {
+			return "", fmt.Errorf("unexpected characters after quoted value")
+		}
+		return s[1 : end+1], nil
+	case '"':
+		var b strings.Builder
+		for i := 1; i < len(s); i++ {
+			c := s[i]
+			switch {
+			case c == '"':
+				if !isDotenvComment(s[i+1:]) {
+					return "", fmt.Errorf("unexpected characters after quoted value")
+				}
+				return b.String(), nil
+			case c == '\\' && i+1 < len(s):
+				i++
+				switch s[i] {
+				case 'n':
+					b.WriteByte('\n')
+				case 't':
+					b.WriteByte('\t')
+				case 'r':
+					b.WriteByte('\r')
+				default:
+					b.WriteByte(s[i])
+				}
+			default:
+				b.WriteByte(c)
+			}
+		}
+		return "", fmt.Errorf("unterminated quoted value")
+	default:
+		// Unquoted values end at a comment preceded by whitespace.
+		if i := strings.Index(s, " #"); i >= 0 {
+			s = s[:i]
+		}
+		if i := strings.Index(s, "\t#"); i >= 0 {
+			s = s[:i]
+		}
+		return strings.TrimSpace(s), nil
+	}
+}
+
+// isDotenvComment reports whether the remainder of a line after a quoted value
+// is empty or a comment.
+func isDotenvComment(s string) bool {
+	s = strings.TrimSpace(s)
+	return s == "" || strings.HasPrefix(s, "#")
+}
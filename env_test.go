@@ -0,0 +1,153 @@
+package mrun
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseDotenv(t *testing.T) {
+	env, err := parseDotenv(strings.NewReader(`# Comment
+PLAIN=value
+SPACED = value with spaces   # Trailing comment
+HASH=a#b
+export EXPORTED=1
+EMPTY=
+SINGLE='literal $HOME \n # not a comment' # Comment
+DOUBLE="line\nnext\ttab \"quoted\" \\ # not a comment"
+QUOTED_EMPTY=""
+dotted.key=x
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"PLAIN=value",
+		"SPACED=value with spaces",
+		"HASH=a#b",
+		"EXPORTED=1",
+		"EMPTY=",
+		`SINGLE=literal $HOME \n # not a comment`,
+		"DOUBLE=line\nnext\ttab \"quoted\" \\ # not a comment",
+		"QUOTED_EMPTY=",
+		"dotted.key=x",
+	}
+	if !slices.Equal(env, want) {
+		t.Errorf("parseDotenv() = %q, want %q", env, want)
+	}
+}
+
+func TestParseDotenvErrors(t *testing.T) {
+	tests := []struct {
+		dotenv string
+		err    string
+	}{
+		{"FOO=1\nBAR\n", "2: invalid line, expected KEY=VALUE"},
+		{"1FOO=1\n", "1: invalid line, expected KEY=VALUE"},
+		{"export\n", "1: invalid line, expected KEY=VALUE"},
+		{"FOO='bar\n", "1: unterminated quoted value"},
+		{"\nFOO=\"bar\n", "2: unterminated quoted value"},
+		{`FOO="bar\"` + "\n", "1: unterminated quoted value"},
+		{"FOO='bar' baz\n", "1: unexpected characters after quoted value"},
+		{`FOO="bar"baz` + "\n", "1: unexpected characters after quoted value"},
+	}
+	for _, tt := range tests {
+		_, err := parseDotenv(strings.NewReader(tt.dotenv))
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("parseDotenv(%q) error = %v, want %q", tt.dotenv, err, tt.err)
+		}
+	}
+}
+
+func TestExpandVars(t *testing.T) {
+	env := []string{"FOO=foo", "BAR=bar", "FOO=override", "EMPTY="}
+	tests := []struct {
+		s    string
+		want string
+		err  string
+	}{
+		{"plain", "plain", ""},
+		{"${FOO}", "override", ""},
+		{"${BAR}/${FOO}-${EMPTY}x", "bar/override-x", ""},
+		{"$FOO ${} ${1X} $${BAR}", "$FOO ${} ${1X} $bar", ""},
+		{"a ${MISSING} b", "", `undefined variable MISSING in "a ${MISSING} b"`},
+	}
+	for _, tt := range tests {
+		got, err := expandVars(tt.s, env)
+		switch {
+		case tt.err != "" && (err == nil || err.Error() != tt.err):
+			t.Errorf("expandVars(%q) error = %v, want %q", tt.s, err, tt.err)
+		case tt.err == "" && (err != nil || got != tt.want):
+			t.Errorf("expandVars(%q) = %q, %v; want %q", tt.s, got, err, tt.want)
+		}
+	}
+}
+
+func TestDedupEnv(t *testing.T) {
+	got := dedupEnv([]string{"A=1", "B=2", "A=3", "C=4", "B=5"})
+	if want := []string{"A=3", "C=4", "B=5"}; !slices.Equal(got, want) {
+		t.Errorf("dedupEnv() = %q, want %q", got, want)
+	}
+	if got := dedupEnv(nil); got == nil || len(got) != 0 {
+		t.Errorf("dedupEnv(nil) = %#v, want empty non-nil slice", got)
+	}
+}
+
+func TestCommandEnvironPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(path, []byte("FROM_FILE=file\nOVERRIDDEN=file\nINHERITED=file\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("true")
+	cmd.Env = []string{"INHERITED=cmd", "UNSET=cmd", "OVERRIDDEN=cmd"}
+	// Options are applied in a fixed order regardless of the order given.
+	c := NewCommand(cmd,
+		WithEnv([]string{"OVERRIDDEN=env"}),
+		WithEnvFile(path),
+		WithEnvUnset("UNSET"),
+	)
+	env, err := c.environ()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"FROM_FILE=file", "INHERITED=file", "OVERRIDDEN=env"}
+	if !slices.Equal(env, want) {
+		t.Errorf("environ() = %q, want %q", env, want)
+	}
+
+	c = NewCommand(exec.Command("true"), WithCleanEnv(), WithEnvFile(filepath.Join(t.TempDir(), "missing.env")))
+	if _, err := c.environ(); !os.IsNotExist(err) {
+		t.Errorf("environ() with missing env file: error = %v, want not exist", err)
+	}
+}
+
+func TestPrepareExpandVars(t *testing.T) {
+	cmd := exec.Command("echo", "${GREETING}", "${DIR}")
+	cmd.Dir = "${DIR}"
+	c := NewCommand(cmd, WithCleanEnv(), WithEnv([]string{"GREETING=hi", "DIR=/tmp"}), WithExpandVars())
+	if err := c.prepare(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"echo", "hi", "/tmp"}; !slices.Equal(c.cmd.Args, want) || c.cmd.Dir != "/tmp" {
+		t.Errorf("args = %q, dir = %q; want %q, /tmp", c.cmd.Args, c.cmd.Dir, want)
+	}
+
+	// Arguments are left alone without WithExpandVars, e.g. for shell scripts.
+	c = NewCommand(exec.Command("sh", "-c", "x=1; echo ${x}"))
+	if err := c.prepare(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"sh", "-c", "x=1; echo ${x}"}; !slices.Equal(c.cmd.Args, want) {
+		t.Errorf("args = %q, want %q", c.cmd.Args, want)
+	}
+
+	cmd = exec.Command("true")
+	cmd.Dir = "${MISSING}"
+	c = NewCommand(cmd, WithCleanEnv())
+	if err := c.prepare(); err == nil || !strings.Contains(err.Error(), "undefined variable MISSING") {
+		t.Errorf("prepare() with undefined variable in dir: error = %v", err)
+	}
+}
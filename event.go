@@ -0,0 +1,59 @@
+package mrun
+
+import "time"
+
+// EventType is the type of an [Event].
+type EventType int
+
+const (
+	// The command has produced no output for the duration set with
+	// [WithStallWarning].
+	EventStalled EventType = iota
+	// The command has produced output again after being stalled.
+	EventResumed
+	// The command is being terminated after producing no output for the
+	// duration set with [WithStallTimeout].
+	EventStallTimeout
+	// One of the readiness probes of the command has succeeded, see
+	// [WithReadyWhen].
+	EventReady
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventStalled:
+		return "stalled"
+	case EventResumed:
+		return "resumed"
+	case EventStallTimeout:
+		return "stall timeout"
+	case EventReady:
+		return "ready"
+	default:
+		return "unknown"
+	}
+}
+
+// Event is an event of a command in the grid, see [WithEventHandler].
+type Event struct {
+	Type    EventType
+	Command *Command
+	// Time of the event.
+	Time time.Time
+}
+
+// WithEventHandler sets a function called with events of the commands, e.g.
+// when a command stalls (see [WithStallWarning]). The handler is called from
+// the event loop of the grid, so it should return quickly.
+func WithEventHandler(handler func(Event)) RunOption {
+	return func(o *runOpts) {
+		o.eventHandler = handler
+	}
+}
+
+// emit passes an event of cmd to the event handler, if any.
+func (m model) emit(typ EventType, cmd *Command) {
+	if m.opts.eventHandler != nil {
+		m.opts.eventHandler(Event{Type: typ, Command: cmd, Time: time.Now()})
+	}
+}
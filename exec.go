@@ -3,29 +3,53 @@ package mrun
 import (
 	"bufio"
 	"bytes"
+	"fmt"
 	"os/exec"
+	"slices"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
 	"github.com/creack/pty"
 )
 
 type cmdOutputMsg struct {
-	paneIdx int
-	ch      <-chan tea.Msg
-	line    []byte
+	cmd  *Command
+	ch   <-chan tea.Msg
+	line []byte
+	// Arrival time of the line.
+	time time.Time
 }
 
 type cmdExitMsg struct {
-	paneIdx  int
+	cmd      *Command
 	exited   bool
 	exitCode int
 	errored  bool
 	err      error
 }
 
+type cmdReadyMsg struct {
+	cmd *Command
+	ch  <-chan tea.Msg
+}
+
+// cmdStoppedMsg is sent when a command stopped with multiExecutor.stop is done.
+type cmdStoppedMsg struct {
+	cmd *Command
+	// Whether the command should be restarted.
+	restart bool
+}
+
+// cmdStartedMsg is sent when the process of a command is started.
+type cmdStartedMsg struct {
+	cmd *Command
+	ch  <-chan tea.Msg
+	pid int
+}
+
 type (
 	allDoneMsg       struct{}
 	allTerminatedMsg struct{}
@@ -33,52 +57,89 @@ type (
 
 type multiExecutor struct {
 	sync.Mutex
-	cmds         []*Command
-	terminating  atomic.Bool
-	wg           sync.WaitGroup
-	successCount int
+	cmds        []*Command
+	terminating atomic.Bool
+	// Number of commands still running, guarded by the mutex. A WaitGroup
+	// can't be used since commands may be added while waiting.
+	running  int
+	idleCond *sync.Cond
+	// Set if commands were still running when terminateAll was called, i.e.
+	// the grid was quit prematurely, guarded by the mutex.
+	interrupted bool
+	// Style of errors running commands, shown in their panes.
+	errorStyle lipgloss.Style
 }
 
-func newMultiExecutor() *multiExecutor {
-	return &multiExecutor{}
+func newMultiExecutor(errorStyle lipgloss.Style) *multiExecutor {
+	ex := &multiExecutor{errorStyle: errorStyle}
+	ex.idleCond = sync.NewCond(&ex.Mutex)
+	return ex
 }
 
-func (ex *multiExecutor) runCommand(paneIdx, w, h int, cmd *Command) (chan<- winsize, tea.Cmd) {
+func (ex *multiExecutor) runCommand(cmd *Command, w, h int) (chan<- winsize, tea.Cmd) {
 	if ex.terminating.Load() {
 		return nil, nil
 	}
 
 	ex.Lock()
 	ex.cmds = append(ex.cmds, cmd)
+	ex.running++
 	ex.Unlock()
 
+	cmd.startTime = time.Now()
+
 	ch := make(chan tea.Msg, 100)
 	winsizeCh := make(chan winsize)
+	cmd.finished = make(chan struct{})
 	sendOutput := func(line []byte) {
 		ch <- cmdOutputMsg{
-			paneIdx: paneIdx,
-			ch:      ch,
-			line:    line,
+			cmd:  cmd,
+			ch:   ch,
+			line: line,
+			time: time.Now(),
 		}
 	}
-	ex.wg.Add(1)
 	go func() {
-		defer ex.wg.Done()
-		defer func() { cmd.done = true }()
+		// Nothing is sent on the channel after this goroutine is done; close
+		// it so that a pending nextOutput doesn't block forever, e.g. after the
+		// command is stopped.
+		defer func() {
+			close(ch)
+			close(cmd.finished)
+		}()
+		defer func() {
+			ex.Lock()
+			ex.running--
+			if ex.running == 0 {
+				ex.idleCond.Broadcast()
+			}
+			ex.Unlock()
+		}()
+		defer func() {
+			cmd.endTime = time.Now()
+			cmd.done = true
+		}()
 
 		handleError := func(exitErr error) {
 			ch <- cmdOutputMsg{
-				paneIdx: paneIdx,
-				ch:      ch,
-				line:    []byte(_errorStyle.Render(exitErr.Error())),
+				cmd:  cmd,
+				ch:   ch,
+				line: []byte(ex.errorStyle.Render(exitErr.Error())),
+				time: time.Now(),
 			}
 			ch <- cmdExitMsg{
-				paneIdx: paneIdx,
+				cmd:     cmd,
 				errored: true,
 				err:     exitErr,
 			}
 		}
 
+		if err := cmd.prepare(); err != nil {
+			cmd.err = err
+			handleError(err)
+			return
+		}
+
 		ptmx, err := pty.StartWithSize(cmd.cmd, &pty.Winsize{
 			Rows: uint16(h),
 			Cols: uint16(w),
@@ -88,6 +149,41 @@ func (ex *multiExecutor) runCommand(paneIdx, w, h int, cmd *Command) (chan<- win
 			handleError(err)
 			return
 		}
+		ch <- cmdStartedMsg{cmd: cmd, ch: ch, pid: cmd.cmd.Process.Pid}
+
+		markReady := func() {
+			if cmd.ready.CompareAndSwap(false, true) {
+				ch <- cmdReadyMsg{cmd: cmd, ch: ch}
+			}
+		}
+		if len(cmd.probes) == 0 {
+			cmd.ready.Store(true)
+		}
+
+		// Poll port and file readiness probes until one succeeds or the
+		// command's output is exhausted. The poller must be stopped before
+		// cmdExitMsg is sent, since the channel is not drained after that.
+		stopProbing := make(chan struct{})
+		var probing sync.WaitGroup
+		if cmd.hasPollingProbes() {
+			probing.Add(1)
+			go func() {
+				defer probing.Done()
+				ticker := time.NewTicker(_readyPollInterval)
+				defer ticker.Stop()
+				for !cmd.ready.Load() {
+					if cmd.pollReady() {
+						markReady()
+						return
+					}
+					select {
+					case <-stopProbing:
+						return
+					case <-ticker.C:
+					}
+				}
+			}()
+		}
 
 		// Handle window resize.
 		go func() {
@@ -131,10 +227,16 @@ func (ex *multiExecutor) runCommand(paneIdx, w, h int, cmd *Command) (chan<- win
 			return 0, nil, nil
 		})
 		for scanner.Scan() {
-			sendOutput(scanner.Bytes())
+			line := scanner.Bytes()
+			sendOutput(line)
+			if !cmd.ready.Load() && cmd.matchesOutput(line) {
+				markReady()
+			}
 		}
+		close(stopProbing)
+		probing.Wait()
 
-		if ex.terminating.Load() {
+		if ex.terminating.Load() || cmd.terminating.Load() {
 			// If we're terminating, the process is already waited in
 			// cmd.gracefullyTerminate(), so we don't double-wait here,
 			// otherwise we may get a spurious "wait: no child processes" error.
@@ -143,27 +245,32 @@ func (ex *multiExecutor) runCommand(paneIdx, w, h int, cmd *Command) (chan<- win
 
 		err = cmd.cmd.Wait()
 		if err != nil {
-			cmd.err = err
 			// Check if the err is a regular non-zero exit code.
 			if _, ok := err.(*exec.ExitError); !ok {
+				cmd.err = err
 				handleError(err)
 				return
 			}
+		}
+		exitCode := cmd.cmd.ProcessState.ExitCode()
+		if cmd.isSuccessExitCode(exitCode) {
+			cmd.succeeded = true
+		} else if err != nil {
+			cmd.err = err
 		} else {
-			ex.Lock()
-			ex.successCount++
-			ex.Unlock()
+			// Exit code 0 isn't successful with WithSuccessExitCodes.
+			cmd.err = fmt.Errorf("exit status %d not in success exit codes", exitCode)
 		}
 		ch <- cmdExitMsg{
-			paneIdx:  paneIdx,
+			cmd:      cmd,
 			exited:   true,
-			exitCode: cmd.cmd.ProcessState.ExitCode(),
+			exitCode: exitCode,
 		}
 	}()
 	return winsizeCh, func() tea.Msg {
 		return cmdOutputMsg{
-			paneIdx: paneIdx,
-			ch:      ch,
+			cmd: cmd,
+			ch:  ch,
 		}
 	}
 }
@@ -175,33 +282,89 @@ func (ex *multiExecutor) nextOutput(msg cmdOutputMsg) tea.Msg {
 	return <-msg.ch
 }
 
+// next returns a command receiving the next message of a command, to be
+// scheduled when handling messages other than cmdOutputMsg sent on the same
+// channel, e.g. cmdReadyMsg.
+func next(ch <-chan tea.Msg) tea.Cmd {
+	return func() tea.Msg {
+		return <-ch
+	}
+}
+
 // waitForAllDone blocks until all commands have exited, then returns an
-// allDoneMsg. Must not be called before all commands have been added with
-// runCommand.
+// allDoneMsg. Commands added with runCommand while waiting are accounted for,
+// but a command added after the message is returned may already be running
+// when the message is handled; the handler should check idle.
 func (ex *multiExecutor) waitForAllDone() tea.Msg {
-	ex.wg.Wait()
+	ex.waitIdle()
 	return allDoneMsg{}
 }
 
+func (ex *multiExecutor) waitIdle() {
+	ex.Lock()
+	defer ex.Unlock()
+	for ex.running > 0 {
+		ex.idleCond.Wait()
+	}
+}
+
+// idle reports whether no command is running.
+func (ex *multiExecutor) idle() bool {
+	ex.Lock()
+	defer ex.Unlock()
+	return ex.running == 0
+}
+
+// remove removes cmd from the executor, gracefully terminating it in the
+// background if it's still running. A removed command no longer counts towards
+// allSuccessful.
+func (ex *multiExecutor) remove(cmd *Command) {
+	ex.Lock()
+	defer ex.Unlock()
+	idx := slices.Index(ex.cmds, cmd)
+	if idx < 0 {
+		return
+	}
+	ex.cmds = slices.Delete(ex.cmds, idx, idx+1)
+	if !cmd.done {
+		cmd.terminating.Store(true)
+		go cmd.gracefullyTerminate()
+	}
+}
+
+// stop gracefully terminates cmd if it's still running, and returns a
+// cmdStoppedMsg once it's done, after which the command can be restarted.
+func (ex *multiExecutor) stop(cmd *Command, restart bool) tea.Cmd {
+	return func() tea.Msg {
+		if !cmd.done {
+			cmd.terminating.Store(true)
+			cmd.gracefullyTerminate()
+		}
+		<-cmd.finished
+		return cmdStoppedMsg{cmd: cmd, restart: restart}
+	}
+}
+
 // terminateAll tries to gracefully terminate all running commands, then returns
 // an allTerminatedMsg. It always returns after 10s even if the commands are
-// somehow stuck even after SIGKILL. Must not be called before all commands have
-// been added with runCommand.
+// somehow stuck even after SIGKILL. No command can be added with runCommand
+// after this is called.
 func (ex *multiExecutor) terminateAll() tea.Msg {
 	ex.terminating.Store(true)
 	ex.Lock()
-	defer ex.Unlock()
 	for _, cmd := range ex.cmds {
 		if cmd.done {
 			continue
 		}
+		ex.interrupted = true
 		go func() {
 			cmd.gracefullyTerminate()
 		}()
 	}
+	ex.Unlock()
 	done := make(chan struct{})
 	go func() {
-		ex.wg.Wait()
+		ex.waitIdle()
 		close(done)
 	}()
 	select {
@@ -211,6 +374,20 @@ func (ex *multiExecutor) terminateAll() tea.Msg {
 	return allTerminatedMsg{}
 }
 
+// allSuccessful reports whether all commands exited successfully, honoring
+// [WithSuccessExitCodes] and [WithAllowFailure]. It's false if the grid was
+// quit while commands were still running, even if only commands allowed to
+// fail were.
 func (ex *multiExecutor) allSuccessful() bool {
-	return ex.successCount == len(ex.cmds)
+	ex.Lock()
+	defer ex.Unlock()
+	if ex.interrupted {
+		return false
+	}
+	for _, cmd := range ex.cmds {
+		if !cmd.succeeded && !cmd.allowFailure {
+			return false
+		}
+	}
+	return true
 }
@@ -32,6 +32,8 @@ func (cmd *Command) gracefullyTerminate() {
 	state, err := proc.Wait()
 	if err != nil {
 		cmd.err = err
+		done.Store(true)
+		return
 	}
 	// os.Process.Wait() doesn't return an error on non-zero exit status, so we
 	// manually check and set here. Modeled on os/exec.Cmd.Wait():
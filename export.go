@@ -0,0 +1,94 @@
+package mrun
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/ansi"
+)
+
+var _unsafeFilenameRegexp = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// pagerDoneMsg is sent when the pager opened with openInPager exits.
+type pagerDoneMsg struct {
+	err error
+}
+
+// text returns the full output of the pane, unwrapped, with timestamps if
+// they're shown, optionally stripped of ANSI escape sequences.
+func (p *modelPane) text(strip bool) string {
+	var b strings.Builder
+	lines := append(p.lines[:len(p.lines):len(p.lines)], p.lastLine)
+	for i, l := range lines {
+		if i == len(lines)-1 && l.text == "" {
+			break
+		}
+		if p.showTimestamps && !l.time.IsZero() {
+			b.WriteString(p.formatTimestamp(l.time))
+			b.WriteByte(' ')
+		}
+		if strip {
+			b.WriteString(ansi.Strip(l.text))
+		} else {
+			b.WriteString(l.text)
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// openInPager returns a command that suspends the TUI and opens the full output
+// of the pane in $PAGER (less -R by default), resuming the TUI afterwards.
+func (p *modelPane) openInPager() tea.Cmd {
+	f, err := os.CreateTemp("", "mrun-*.log")
+	if err != nil {
+		return showFeedback(fmt.Sprintf("Error: %s", err))
+	}
+	path := f.Name()
+	_, err = f.WriteString(p.text(false))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(path)
+		return showFeedback(fmt.Sprintf("Error: %s", err))
+	}
+	pager := os.Getenv("PAGER")
+	if pager == "" {
+		pager = "less -R"
+	}
+	// Let the shell split $PAGER, which may contain arguments.
+	c := exec.Command("sh", "-c", pager+` "$1"`, "sh", path)
+	return tea.ExecProcess(c, func(err error) tea.Msg {
+		_ = os.Remove(path)
+		return pagerDoneMsg{err}
+	})
+}
+
+// saveToFile saves the full output of the pane, stripped of ANSI escape
+// sequences, to a timestamped file in the current directory, and returns the
+// path.
+func (p *modelPane) saveToFile() (string, error) {
+	name := p.label
+	if name == "" {
+		name = p.title
+	}
+	name = strings.Trim(_unsafeFilenameRegexp.ReplaceAllString(name, "_"), "_")
+	if name == "" {
+		name = "pane"
+	}
+	path := fmt.Sprintf("mrun-%s-%s.log", name, time.Now().Format("20060102-150405"))
+	if err := os.WriteFile(path, []byte(p.text(true)), 0o644); err != nil {
+		return "", err
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return path, nil
+}
@@ -0,0 +1,90 @@
+package mrun
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/cursor"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// WithFilter only shows lines of output of the command matching pattern, or
+// not matching pattern if invert is true. Lines are matched without ANSI
+// escape sequences. Filtered out lines are kept, and shown again when the
+// filter is changed or cleared interactively with /.
+func WithFilter(pattern *regexp.Regexp, invert bool) CommandOption {
+	return func(c *Command) {
+		c.filter = pattern
+		c.filterInvert = invert
+	}
+}
+
+// hidden reports whether a line is filtered out of the pane.
+func (p *modelPane) hidden(l paneLine) bool {
+	if p.filter == nil {
+		return false
+	}
+	return p.filter.MatchString(l.plain) == p.filterInvert
+}
+
+// setFilter sets or clears (if pattern is nil) the filter of the pane, and
+// scrolls to the bottom.
+func (p *modelPane) setFilter(pattern *regexp.Regexp, invert bool) {
+	p.filter = pattern
+	p.filterInvert = invert
+	p.refreshContent()
+	p.v.GotoBottom()
+}
+
+// filterString returns the filter of the pane as entered in the filter prompt,
+// i.e. the pattern prefixed with ! if inverted.
+func (p *modelPane) filterString() string {
+	if p.filter == nil {
+		return ""
+	}
+	if p.filterInvert {
+		return "!" + p.filter.String()
+	}
+	return p.filter.String()
+}
+
+// newFilterInput creates the input of the filter prompt, prefilled with the
+// current filter of the pane.
+func newFilterInput(p *modelPane) textinput.Model {
+	ti := textinput.New()
+	ti.Prompt = "/"
+	ti.PromptStyle = p.styles.activeOverlay
+	ti.Cursor.SetMode(cursor.CursorStatic)
+	ti.Width = max(p.vw-4, 1)
+	ti.SetValue(p.filterString())
+	ti.Focus()
+	return ti
+}
+
+// updateFilterPrompt handles a key in the filter prompt. FilterApply applies
+// the filter, where a leading ! inverts it and an empty pattern clears it;
+// FilterCancel cancels. It reports whether the prompt should be closed.
+func (p *modelPane) updateFilterPrompt(km KeyMap, ti *textinput.Model, msg tea.KeyMsg) (done bool, cmd tea.Cmd) {
+	switch {
+	case key.Matches(msg, km.FilterCancel):
+		return true, nil
+	case key.Matches(msg, km.FilterApply):
+		s := ti.Value()
+		if s == "" {
+			p.setFilter(nil, false)
+			return true, nil
+		}
+		invert := strings.HasPrefix(s, "!")
+		re, err := regexp.Compile(strings.TrimPrefix(s, "!"))
+		if err != nil {
+			return false, showFeedback(fmt.Sprintf("Invalid filter: %s", err))
+		}
+		p.setFilter(re, invert)
+		return true, nil
+	}
+	*ti, cmd = ti.Update(msg)
+	return false, cmd
+}
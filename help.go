@@ -0,0 +1,45 @@
+package mrun
+
+import (
+	"github.com/charmbracelet/bubbles/key"
+)
+
+// WithHelpFooter shows a line of short help for the most common key bindings
+// below the grid. The full help is shown with ? regardless.
+func WithHelpFooter() RunOption {
+	return func(o *runOpts) {
+		o.helpFooter = true
+	}
+}
+
+// ShortHelp returns the bindings shown in the help footer (see
+// [WithHelpFooter]). Together with FullHelp, it implements the KeyMap
+// interface of the bubbles help component.
+func (km KeyMap) ShortHelp() []key.Binding {
+	return []key.Binding{km.Help, km.Quit, km.NextPane, km.CopyMode, km.Filter}
+}
+
+// FullHelp returns the bindings shown in the help overlay, in columns.
+func (km KeyMap) FullHelp() [][]key.Binding {
+	return [][]key.Binding{
+		{km.Quit, km.Interrupt, km.NextPane, km.PrevPane, km.NextActivity, km.ToggleMouse, km.Help},
+		{km.ScrollUp, km.ScrollDown, km.PageUp, km.PageDown, km.HalfPageUp, km.HalfPageDown, km.GotoTop, km.GotoBottom, km.ScrollLeft, km.ScrollRight},
+		{km.ToggleTimestamps, km.ToggleWrap, km.CopyMode, km.Filter, km.Pager, km.Save, km.Zoom, km.Restart, km.Stop},
+		{km.SelectStream, km.SelectLine, km.SelectBlock, km.Yank, km.CopyCancel},
+	}
+}
+
+// helpView renders the help overlay listing all key bindings.
+func (m model) helpView() string {
+	h := m.help
+	h.ShowAll = true
+	h.Width = max(m.width-m.styles.helpBox.GetHorizontalFrameSize(), 0)
+	return m.styles.helpBox.Render(h.View(m.opts.keyMap))
+}
+
+// helpFooterView renders the short help line below the grid.
+func (m model) helpFooterView() string {
+	h := m.help
+	h.Width = m.width
+	return h.View(m.opts.keyMap)
+}
@@ -0,0 +1,206 @@
+package mrun
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// highlight is a rule highlighting matches of pattern in the output with style.
+type highlight struct {
+	pattern *regexp.Regexp
+	style   lipgloss.Style
+}
+
+// Escape sequences: CSI (including SGR), OSC, and two-byte sequences.
+var _escapeRegexp = regexp.MustCompile(`\x1b\[[0-?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)|\x1b[@-Z\\-_]`)
+
+// WithHighlight highlights matches of pattern in the output of every pane
+// with style, e.g.
+//
+//	WithHighlight(regexp.MustCompile(`ERROR|FAIL|panic:`), lipgloss.NewStyle().Foreground(lipgloss.Color("196")))
+//
+// Only the text attributes of style (colors, bold, etc.) are used. Patterns
+// are matched against output without ANSI escape sequences, and colors of the
+// output are restored after each match. The number of lines matching each
+// pattern is shown in a badge at the bottom of the pane. WithHighlight can be
+// used multiple times; the first matching rule takes precedence where matches
+// overlap.
+//
+// Use [WithCommandHighlight] to highlight the output of individual commands.
+func WithHighlight(pattern *regexp.Regexp, style lipgloss.Style) RunOption {
+	return func(o *runOpts) {
+		o.highlights = append(o.highlights, highlight{pattern, style})
+	}
+}
+
+// WithCommandHighlight is like [WithHighlight], for the command only. Rules
+// of the command take precedence over those of [WithHighlight].
+func WithCommandHighlight(pattern *regexp.Regexp, style lipgloss.Style) CommandOption {
+	return func(c *Command) {
+		c.highlights = append(c.highlights, highlight{pattern, style})
+	}
+}
+
+// sgr returns the escape sequences that start and end the text attributes of
+// the style, which may be empty depending on the color profile.
+func (h highlight) sgr() (start, end string) {
+	const marker = "x"
+	s := h.style.Inline(true).Render(marker)
+	i := strings.Index(s, marker)
+	if i < 0 {
+		return "", ""
+	}
+	return s[:i], s[i+len(marker):]
+}
+
+type highlightSpan struct {
+	// Byte offsets in the text without escape sequences.
+	from, to int
+	rule     int
+}
+
+// highlightLine highlights matches of the rules in a line that may contain
+// escape sequences, and reports which rules matched. starts and ends are the
+// results of sgr() for each rule.
+//
+// Escape sequences of the line are kept. Since an SGR sequence within a match
+// (e.g. a reset) may override the highlight, the highlight is re-applied after
+// each one; and since the highlight ends with a reset, SGR sequences of the
+// line seen since its last reset are re-applied after each match.
+func highlightLine(line string, rules []highlight, starts, ends []string, matched []bool) string {
+	// Map offsets in the stripped line to offsets in the line.
+	escapes := _escapeRegexp.FindAllStringIndex(line, -1)
+	var plain strings.Builder
+	offsets := make([]int, 0, len(line)+1)
+	pos := 0
+	for _, e := range append(escapes, []int{len(line), len(line)}) {
+		for i := pos; i < e[0]; i++ {
+			offsets = append(offsets, i)
+			plain.WriteByte(line[i])
+		}
+		pos = e[1]
+	}
+	offsets = append(offsets, len(line))
+	text := plain.String()
+
+	var spans []highlightSpan
+	for rule, h := range rules {
+		for _, loc := range h.pattern.FindAllStringIndex(text, -1) {
+			if loc[0] == loc[1] {
+				continue
+			}
+			matched[rule] = true
+			overlaps := false
+			for _, s := range spans {
+				if loc[0] < s.to && s.from < loc[1] {
+					overlaps = true
+					break
+				}
+			}
+			if !overlaps {
+				spans = append(spans, highlightSpan{loc[0], loc[1], rule})
+			}
+		}
+	}
+	if len(spans) == 0 {
+		return line
+	}
+
+	// Per offset in the stripped line, the span covering it, if any.
+	cover := make([]int, len(text)+1)
+	for i := range cover {
+		cover[i] = -1
+	}
+	for i, s := range spans {
+		for j := s.from; j < s.to; j++ {
+			cover[j] = i
+		}
+	}
+
+	var b strings.Builder
+	// SGR sequences of the line since its last reset.
+	var sgrState strings.Builder
+	current, k := -1, 0
+	for i := 0; i <= len(text); i++ {
+		next := cover[i]
+		if next != current && current >= 0 {
+			b.WriteString(ends[spans[current].rule])
+			b.WriteString(sgrState.String())
+		}
+		// Copy escape sequences preceding the byte, tracking SGR state.
+		for ; k < len(escapes) && escapes[k][0] < offsets[i]; k++ {
+			seq := line[escapes[k][0]:escapes[k][1]]
+			b.WriteString(seq)
+			if strings.HasPrefix(seq, "\x1b[") && strings.HasSuffix(seq, "m") {
+				if seq == "\x1b[m" || seq == "\x1b[0m" {
+					sgrState.Reset()
+				} else {
+					sgrState.WriteString(seq)
+				}
+				if next >= 0 && next == current {
+					b.WriteString(starts[spans[next].rule])
+				}
+			}
+		}
+		if next != current && next >= 0 {
+			b.WriteString(starts[spans[next].rule])
+		}
+		current = next
+		if i < len(text) {
+			b.WriteByte(line[offsets[i]])
+		}
+	}
+	return b.String()
+}
+
+// newLine prepares a line of output for rendering, highlighting it and
+// reporting which highlight rules matched in matched.
+func (p *modelPane) newLine(text string, t time.Time, matched []bool) paneLine {
+	l := paneLine{text: text, plain: ansi.Strip(text), highlighted: text, time: t}
+	if len(p.highlights) > 0 {
+		l.highlighted = highlightLine(text, p.highlights, p.highlightStarts, p.highlightEnds, matched)
+	}
+	return l
+}
+
+// appendLine appends a complete line of output to the pane, counting the
+// highlight rules it matches.
+func (p *modelPane) appendLine(text string, t time.Time) {
+	matched := make([]bool, len(p.highlights))
+	p.lines = append(p.lines, p.newLine(text, t, matched))
+	for rule, ok := range matched {
+		if ok {
+			p.highlightCounts[rule]++
+		}
+	}
+}
+
+// setLastLine sets the last line of output of the pane, which isn't complete
+// yet.
+func (p *modelPane) setLastLine(text string, t time.Time) {
+	clear(p.lastLineMatches)
+	p.lastLine = p.newLine(text, t, p.lastLineMatches)
+}
+
+// highlightBadge renders the number of lines matching each highlight rule in
+// the style of the rule, omitting rules without matches.
+func (p *modelPane) highlightBadge() string {
+	var counts []string
+	for i, n := range p.highlightCounts {
+		if p.lastLineMatches[i] {
+			n++
+		}
+		if n > 0 {
+			counts = append(counts, p.highlights[i].style.Inline(true).Render(strconv.Itoa(n)))
+		}
+	}
+	if len(counts) == 0 {
+		return ""
+	}
+	return " " + strings.Join(counts, " ") + " "
+}
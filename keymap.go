@@ -0,0 +1,162 @@
+package mrun
+
+import (
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/viewport"
+)
+
+// KeyMap defines the key bindings of the grid. Start from [DefaultKeyMap] and
+// override bindings as needed, then pass it to [WithKeyMap]. A binding can be
+// disabled with its SetEnabled method, or by setting it to a zero
+// [key.Binding].
+type KeyMap struct {
+	// Opens the exit dialog, also in copy mode and in the filter prompt.
+	Interrupt key.Binding
+	// Opens the exit dialog.
+	Quit     key.Binding
+	NextPane key.Binding
+	PrevPane key.Binding
+	// Focuses the next pane with unseen output or a bell.
+	NextActivity key.Binding
+	// Toggles the help overlay.
+	Help key.Binding
+
+	// Scrolling in the active pane.
+	ScrollUp     key.Binding
+	ScrollDown   key.Binding
+	PageUp       key.Binding
+	PageDown     key.Binding
+	HalfPageUp   key.Binding
+	HalfPageDown key.Binding
+	GotoTop      key.Binding
+	GotoBottom   key.Binding
+	// Horizontal scrolling in no-wrap mode.
+	ScrollLeft  key.Binding
+	ScrollRight key.Binding
+
+	// Actions on the active pane.
+	ToggleTimestamps key.Binding
+	ToggleWrap       key.Binding
+	CopyMode         key.Binding
+	Filter           key.Binding
+	Pager            key.Binding
+	Save             key.Binding
+	ToggleMouse      key.Binding
+	Zoom             key.Binding
+	Restart          key.Binding
+	Stop             key.Binding
+
+	// Copy mode.
+	CopyUp           key.Binding
+	CopyDown         key.Binding
+	CopyLeft         key.Binding
+	CopyRight        key.Binding
+	CopyLineStart    key.Binding
+	CopyLineEnd      key.Binding
+	CopyTop          key.Binding
+	CopyBottom       key.Binding
+	CopyHalfPageUp   key.Binding
+	CopyHalfPageDown key.Binding
+	CopyPageUp       key.Binding
+	CopyPageDown     key.Binding
+	SelectStream     key.Binding
+	SelectLine       key.Binding
+	SelectBlock      key.Binding
+	Yank             key.Binding
+	// Clears the selection, or exits copy mode if nothing is selected.
+	CopyCancel key.Binding
+
+	// Filter prompt.
+	FilterApply  key.Binding
+	FilterCancel key.Binding
+
+	// Dialog.
+	DialogNext    key.Binding
+	DialogPrev    key.Binding
+	DialogLeft    key.Binding
+	DialogRight   key.Binding
+	DialogConfirm key.Binding
+	DialogCancel  key.Binding
+}
+
+// DefaultKeyMap returns the default key bindings, listed in the README.
+func DefaultKeyMap() KeyMap {
+	return KeyMap{
+		Interrupt:    key.NewBinding(key.WithKeys("ctrl+c"), key.WithHelp("ctrl+c", "interrupt")),
+		Quit:         key.NewBinding(key.WithKeys("q", "esc"), key.WithHelp("q/esc", "quit")),
+		NextPane:     key.NewBinding(key.WithKeys("tab"), key.WithHelp("tab", "next pane")),
+		PrevPane:     key.NewBinding(key.WithKeys("shift+tab"), key.WithHelp("shift+tab", "previous pane")),
+		NextActivity: key.NewBinding(key.WithKeys("a"), key.WithHelp("a", "next pane with activity")),
+		Help:         key.NewBinding(key.WithKeys("?"), key.WithHelp("?", "help")),
+
+		ScrollUp:     key.NewBinding(key.WithKeys("up", "k"), key.WithHelp("↑/k", "scroll up")),
+		ScrollDown:   key.NewBinding(key.WithKeys("down", "j"), key.WithHelp("↓/j", "scroll down")),
+		PageUp:       key.NewBinding(key.WithKeys("pgup", "b"), key.WithHelp("pgup/b", "page up")),
+		PageDown:     key.NewBinding(key.WithKeys("pgdown", " ", "f"), key.WithHelp("pgdn/f", "page down")),
+		HalfPageUp:   key.NewBinding(key.WithKeys("u", "ctrl+u"), key.WithHelp("u", "½ page up")),
+		HalfPageDown: key.NewBinding(key.WithKeys("d", "ctrl+d"), key.WithHelp("d", "½ page down")),
+		GotoTop:      key.NewBinding(key.WithKeys("home", "g"), key.WithHelp("home/g", "top")),
+		GotoBottom:   key.NewBinding(key.WithKeys("end", "G"), key.WithHelp("end/G", "bottom")),
+		ScrollLeft:   key.NewBinding(key.WithKeys("left", "h"), key.WithHelp("←/h", "scroll left")),
+		ScrollRight:  key.NewBinding(key.WithKeys("right", "l"), key.WithHelp("→/l", "scroll right")),
+
+		ToggleTimestamps: key.NewBinding(key.WithKeys("t"), key.WithHelp("t", "timestamps")),
+		ToggleWrap:       key.NewBinding(key.WithKeys("w"), key.WithHelp("w", "wrap lines")),
+		CopyMode:         key.NewBinding(key.WithKeys("c"), key.WithHelp("c", "copy mode")),
+		Filter:           key.NewBinding(key.WithKeys("/"), key.WithHelp("/", "filter")),
+		Pager:            key.NewBinding(key.WithKeys("p"), key.WithHelp("p", "open in pager")),
+		Save:             key.NewBinding(key.WithKeys("s"), key.WithHelp("s", "save to file")),
+		ToggleMouse:      key.NewBinding(key.WithKeys("m"), key.WithHelp("m", "mouse capture")),
+		Zoom:             key.NewBinding(key.WithKeys("z"), key.WithHelp("z", "zoom")),
+		Restart:          key.NewBinding(key.WithKeys("r"), key.WithHelp("r", "restart")),
+		Stop:             key.NewBinding(key.WithKeys("x"), key.WithHelp("x", "stop")),
+
+		CopyUp:           key.NewBinding(key.WithKeys("k", "up"), key.WithHelp("↑/k", "up")),
+		CopyDown:         key.NewBinding(key.WithKeys("j", "down"), key.WithHelp("↓/j", "down")),
+		CopyLeft:         key.NewBinding(key.WithKeys("h", "left"), key.WithHelp("←/h", "left")),
+		CopyRight:        key.NewBinding(key.WithKeys("l", "right"), key.WithHelp("→/l", "right")),
+		CopyLineStart:    key.NewBinding(key.WithKeys("0", "home"), key.WithHelp("0", "line start")),
+		CopyLineEnd:      key.NewBinding(key.WithKeys("$", "end"), key.WithHelp("$", "line end")),
+		CopyTop:          key.NewBinding(key.WithKeys("g"), key.WithHelp("g", "top")),
+		CopyBottom:       key.NewBinding(key.WithKeys("G"), key.WithHelp("G", "bottom")),
+		CopyHalfPageUp:   key.NewBinding(key.WithKeys("ctrl+u"), key.WithHelp("ctrl+u", "½ page up")),
+		CopyHalfPageDown: key.NewBinding(key.WithKeys("ctrl+d"), key.WithHelp("ctrl+d", "½ page down")),
+		CopyPageUp:       key.NewBinding(key.WithKeys("ctrl+b", "pgup"), key.WithHelp("ctrl+b", "page up")),
+		CopyPageDown:     key.NewBinding(key.WithKeys("ctrl+f", "pgdown"), key.WithHelp("ctrl+f", "page down")),
+		SelectStream:     key.NewBinding(key.WithKeys("v"), key.WithHelp("v", "select")),
+		SelectLine:       key.NewBinding(key.WithKeys("V"), key.WithHelp("V", "select lines")),
+		SelectBlock:      key.NewBinding(key.WithKeys("ctrl+v"), key.WithHelp("ctrl+v", "select block")),
+		Yank:             key.NewBinding(key.WithKeys("y", "enter"), key.WithHelp("y", "copy selection")),
+		CopyCancel:       key.NewBinding(key.WithKeys("esc", "q"), key.WithHelp("esc", "exit copy mode")),
+
+		FilterApply:  key.NewBinding(key.WithKeys("enter"), key.WithHelp("enter", "apply")),
+		FilterCancel: key.NewBinding(key.WithKeys("esc"), key.WithHelp("esc", "cancel")),
+
+		DialogNext:    key.NewBinding(key.WithKeys("tab"), key.WithHelp("tab", "next")),
+		DialogPrev:    key.NewBinding(key.WithKeys("shift+tab"), key.WithHelp("shift+tab", "previous")),
+		DialogLeft:    key.NewBinding(key.WithKeys("left"), key.WithHelp("←", "left")),
+		DialogRight:   key.NewBinding(key.WithKeys("right"), key.WithHelp("→", "right")),
+		DialogConfirm: key.NewBinding(key.WithKeys("enter"), key.WithHelp("enter", "confirm")),
+		DialogCancel:  key.NewBinding(key.WithKeys("q", "esc"), key.WithHelp("esc", "cancel")),
+	}
+}
+
+// WithKeyMap sets the key bindings of the grid. The default is
+// [DefaultKeyMap].
+func WithKeyMap(keyMap KeyMap) RunOption {
+	return func(o *runOpts) {
+		o.keyMap = keyMap
+	}
+}
+
+// viewportKeyMap returns the scrolling bindings handled by the viewport.
+func (km KeyMap) viewportKeyMap() viewport.KeyMap {
+	return viewport.KeyMap{
+		PageDown:     km.PageDown,
+		PageUp:       km.PageUp,
+		HalfPageUp:   km.HalfPageUp,
+		HalfPageDown: km.HalfPageDown,
+		Up:           km.ScrollUp,
+		Down:         km.ScrollDown,
+	}
+}
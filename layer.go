@@ -0,0 +1,62 @@
+package mrun
+
+import (
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	zone "github.com/lrstanley/bubblezone"
+)
+
+// layer is a view composited into the final view, with zones of its own.
+// The zone markers of a layer are scanned before the layer is composited, so
+// that they aren't mangled by placeOverlay, and zones of a layer survive being
+// covered by a layer above it.
+//
+// Like the zone manager, the position and size of the layer are recorded when
+// the layer is composited in View, and used for hit testing in Update.
+type layer struct {
+	zones      *zone.Manager
+	x, y, w, h int
+}
+
+func newLayer() *layer {
+	return &layer{zones: zone.New()}
+}
+
+// mark wraps s in the zone id of the layer.
+func (l *layer) mark(id, s string) string {
+	return l.zones.Mark(id, s)
+}
+
+// scan records the zones of view, to be composited at (x, y), and returns the
+// view without zone markers.
+func (l *layer) scan(x, y int, view string) string {
+	view = l.zones.Scan(view)
+	l.x, l.y = x, y
+	l.w, l.h = lipgloss.Size(view)
+	return view
+}
+
+// hide records that the layer is not shown.
+func (l *layer) hide() {
+	l.w, l.h = 0, 0
+}
+
+// covers reports whether the mouse event is within the layer.
+func (l *layer) covers(msg tea.MouseMsg) bool {
+	return msg.X >= l.x && msg.X < l.x+l.w && msg.Y >= l.y && msg.Y < l.y+l.h
+}
+
+// inBounds reports whether the mouse event is within the zone id of the layer.
+func (l *layer) inBounds(id string, msg tea.MouseMsg) bool {
+	if !l.covers(msg) {
+		return false
+	}
+	msg.X -= l.x
+	msg.Y -= l.y
+	return l.zones.Get(id).InBounds(msg)
+}
+
+// close stops the zone manager of the layer.
+func (l *layer) close() {
+	l.zones.Close()
+}
@@ -122,22 +122,33 @@ func getLines(s string) (lines []string, widest int) {
 
 // cutLeft cuts printable characters from the left.
 // This function is heavily based on muesli's ansi and truncate packages.
+//
+// SGR sequences in the cut part are carried over to keep the style of the rest,
+// while other sequences, notably zone markers, are dropped: a zone marker
+// carried over would be moved, or duplicated if the cut part is also kept.
 func cutLeft(s string, cutWidth int) string {
 	var (
 		pos    int
 		isAnsi bool
-		ab     bytes.Buffer
-		b      bytes.Buffer
+		// Start of the current sequence in ab.
+		start int
+		ab    bytes.Buffer
+		b     bytes.Buffer
 	)
 	for _, c := range s {
 		var w int
 		if c == ansi.Marker || isAnsi {
+			if !isAnsi {
+				start = ab.Len()
+			}
 			isAnsi = true
 			ab.WriteRune(c)
 			if ansi.IsTerminator(c) {
 				isAnsi = false
 				if bytes.HasSuffix(ab.Bytes(), []byte("[0m")) {
 					ab.Reset()
+				} else if c != 'm' && pos < cutWidth {
+					ab.Truncate(start)
 				}
 			}
 		} else {
@@ -146,9 +157,12 @@ func cutLeft(s string, cutWidth int) string {
 
 		if pos >= cutWidth {
 			if b.Len() == 0 {
-				if ab.Len() > 0 {
-					b.Write(ab.Bytes())
+				// A sequence starting here is written as is below.
+				pending := ab.Bytes()
+				if c == ansi.Marker {
+					pending = pending[:start]
 				}
+				b.Write(pending)
 				if pos-cutWidth > 1 {
 					b.WriteByte(' ')
 					continue
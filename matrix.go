@@ -0,0 +1,90 @@
+package mrun
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+)
+
+// MatrixAxis is a named dimension of a matrix for [ExpandMatrix] and
+// [ExpandMatrixWithShell].
+type MatrixAxis struct {
+	// Name of the variable set to each of the values.
+	Name   string
+	Values []string
+}
+
+// ExpandMatrix generates a command for each combination of values of the
+// matrix axes, in order, with the first axis varying slowest. For each
+// combination, the variables are set in the environment of the command, and
+// ${NAME} references to them in argv are replaced by their values. The label of
+// each command is the combination of values joined by slashes, e.g.
+// "go1.22/linux", and opts are applied to every command. It's an error for argv
+// to be empty.
+//
+// For example, the following generates 4 commands:
+//
+//	commands, err := mrun.ExpandMatrix(
+//		[]string{"go", "test", "./..."},
+//		[]mrun.MatrixAxis{
+//			{Name: "GOTOOLCHAIN", Values: []string{"go1.22.0", "go1.23.0"}},
+//			{Name: "GOOS", Values: []string{"linux", "darwin"}},
+//		},
+//	)
+func ExpandMatrix(argv []string, axes []MatrixAxis, opts ...CommandOption) ([]*Command, error) {
+	if len(argv) == 0 {
+		return nil, errors.New("argv must not be empty")
+	}
+	var commands []*Command
+	forEachMatrixCombination(axes, func(vars []string, values []string) {
+		args := make([]string, len(argv))
+		for i, arg := range argv {
+			args[i] = substituteVars(arg, vars)
+		}
+		cmd := exec.Command(args[0], args[1:]...)
+		commands = append(commands, NewCommand(cmd, matrixCommandOptions(vars, values, opts)...))
+	})
+	return commands, nil
+}
+
+// ExpandMatrixWithShell is like [ExpandMatrix], but takes a command line to be
+// run with sh (see [NewCommandWithShell]). The variables are left for the shell
+// to expand from the environment, but are substituted in the command line
+// shown in the pane.
+func ExpandMatrixWithShell(cmdline string, axes []MatrixAxis, opts ...CommandOption) []*Command {
+	var commands []*Command
+	forEachMatrixCombination(axes, func(vars []string, values []string) {
+		// The generated command line comes first so that one given in opts
+		// takes precedence.
+		opts := append([]CommandOption{WithCommandLine(substituteVars(cmdline, vars))}, matrixCommandOptions(vars, values, opts)...)
+		commands = append(commands, NewCommandWithShell(cmdline, opts...))
+	})
+	return commands
+}
+
+func matrixCommandOptions(vars []string, values []string, opts []CommandOption) []CommandOption {
+	return append([]CommandOption{
+		WithLabel(strings.Join(values, "/")),
+		WithEnv(vars),
+	}, opts...)
+}
+
+// forEachMatrixCombination calls fn with each combination of values of the
+// axes, both as NAME=VALUE pairs and as plain values.
+func forEachMatrixCombination(axes []MatrixAxis, fn func(vars []string, values []string)) {
+	var walk func(i int, vars []string, values []string)
+	walk = func(i int, vars []string, values []string) {
+		if i == len(axes) {
+			fn(vars, values)
+			return
+		}
+		for _, v := range axes[i].Values {
+			walk(i+1,
+				append(vars[:i:i], axes[i].Name+"="+v),
+				append(values[:i:i], v))
+		}
+	}
+	if len(axes) > 0 {
+		walk(0, nil, nil)
+	}
+}
@@ -0,0 +1,99 @@
+package mrun
+
+import (
+	"slices"
+	"testing"
+)
+
+var _testAxes = []MatrixAxis{
+	{Name: "GO", Values: []string{"go1.22", "go1.23"}},
+	{Name: "OS", Values: []string{"linux", "darwin", "windows"}},
+}
+
+func TestExpandMatrix(t *testing.T) {
+	commands, err := ExpandMatrix(
+		[]string{"build-${GO}", "--os=${OS}", "${OTHER}", "$OS"},
+		_testAxes,
+		WithAllowFailure(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		label string
+		args  []string
+		env   []string
+	}{
+		{"go1.22/linux", []string{"build-go1.22", "--os=linux", "${OTHER}", "$OS"}, []string{"GO=go1.22", "OS=linux"}},
+		{"go1.22/darwin", []string{"build-go1.22", "--os=darwin", "${OTHER}", "$OS"}, []string{"GO=go1.22", "OS=darwin"}},
+		{"go1.22/windows", []string{"build-go1.22", "--os=windows", "${OTHER}", "$OS"}, []string{"GO=go1.22", "OS=windows"}},
+		{"go1.23/linux", []string{"build-go1.23", "--os=linux", "${OTHER}", "$OS"}, []string{"GO=go1.23", "OS=linux"}},
+		{"go1.23/darwin", []string{"build-go1.23", "--os=darwin", "${OTHER}", "$OS"}, []string{"GO=go1.23", "OS=darwin"}},
+		{"go1.23/windows", []string{"build-go1.23", "--os=windows", "${OTHER}", "$OS"}, []string{"GO=go1.23", "OS=windows"}},
+	}
+	if len(commands) != len(tests) {
+		t.Fatalf("got %d commands, want %d", len(commands), len(tests))
+	}
+	for i, tt := range tests {
+		c := commands[i]
+		if c.label != tt.label {
+			t.Errorf("command %d: label = %q, want %q", i, c.label, tt.label)
+		}
+		if !slices.Equal(c.cmd.Args, tt.args) {
+			t.Errorf("command %d: args = %q, want %q", i, c.cmd.Args, tt.args)
+		}
+		if !slices.Equal(c.env, tt.env) {
+			t.Errorf("command %d: env = %q, want %q", i, c.env, tt.env)
+		}
+		if !c.allowFailure {
+			t.Errorf("command %d: options not applied", i)
+		}
+	}
+}
+
+func TestExpandMatrixEdgeCases(t *testing.T) {
+	if _, err := ExpandMatrix(nil, _testAxes); err == nil {
+		t.Error("ExpandMatrix() with empty argv succeeded")
+	}
+	commands, err := ExpandMatrix([]string{"true"}, nil)
+	if err != nil || len(commands) != 0 {
+		t.Errorf("ExpandMatrix() without axes = %d commands, %v; want none", len(commands), err)
+	}
+	commands, err = ExpandMatrix([]string{"true"}, []MatrixAxis{{Name: "X"}})
+	if err != nil || len(commands) != 0 {
+		t.Errorf("ExpandMatrix() with an empty axis = %d commands, %v; want none", len(commands), err)
+	}
+}
+
+func TestExpandMatrixWithShell(t *testing.T) {
+	cmdline := `GOOS=$OS go${GO} build "${OS}"`
+	commands := ExpandMatrixWithShell(cmdline, _testAxes[:1])
+	tests := []struct {
+		label   string
+		cmdline string
+		env     []string
+	}{
+		{"go1.22", `GOOS=$OS gogo1.22 build "${OS}"`, []string{"GO=go1.22"}},
+		{"go1.23", `GOOS=$OS gogo1.23 build "${OS}"`, []string{"GO=go1.23"}},
+	}
+	if len(commands) != len(tests) {
+		t.Fatalf("got %d commands, want %d", len(commands), len(tests))
+	}
+	for i, tt := range tests {
+		c := commands[i]
+		if c.label != tt.label || c.cmdline != tt.cmdline || !slices.Equal(c.env, tt.env) {
+			t.Errorf("command %d: label = %q, cmdline = %q, env = %q; want %q, %q, %q",
+				i, c.label, c.cmdline, c.env, tt.label, tt.cmdline, tt.env)
+		}
+		// The shell expands the variables, not mrun.
+		if want := []string{"sh", "-c", cmdline}; !slices.Equal(c.cmd.Args, want) || !c.shell {
+			t.Errorf("command %d: args = %q, shell = %v; want %q, true", i, c.cmd.Args, c.shell, want)
+		}
+	}
+
+	// A command line given by the caller takes precedence.
+	commands = ExpandMatrixWithShell(cmdline, _testAxes[:1], WithCommandLine("build"), WithLabel("custom"))
+	if c := commands[0]; c.cmdline != "build" || c.label != "custom" {
+		t.Errorf("with options: cmdline = %q, label = %q; want build, custom", c.cmdline, c.label)
+	}
+}
@@ -2,75 +2,159 @@ package mrun
 
 import (
 	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
 
+	"github.com/charmbracelet/bubbles/help"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textinput"
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
-	zone "github.com/lrstanley/bubblezone"
-	"github.com/muesli/reflow/wrap"
-)
-
-var (
-	_activePaneBorderColor   = lipgloss.Color("168") // HotPink3
-	_inactivePaneBorderColor = lipgloss.Color("241") // Grey39
-	_commandColor            = lipgloss.Color("75")  // SteelBlue1
-	_errorColor              = lipgloss.Color("196") // Red1
-
-	_paneStyle = lipgloss.NewStyle().
-			BorderStyle(lipgloss.NormalBorder()).
-			BorderTop(false).
-			BorderRight(true).
-			BorderBottom(true).
-			BorderLeft(false)
-	_activePaneStyle      = _paneStyle.BorderForeground(_activePaneBorderColor)
-	_inactivePaneStyle    = _paneStyle.BorderForeground(_inactivePaneBorderColor)
-	_activeOverlayStyle   = lipgloss.NewStyle().Foreground(_activePaneBorderColor)
-	_inactiveOverlayStyle = lipgloss.NewStyle().Foreground(_inactivePaneBorderColor)
-	_commandStyle         = lipgloss.NewStyle().
-				Foreground(_commandColor).
-				BorderStyle(lipgloss.NormalBorder()).
-				BorderForeground(_commandColor).
-				BorderBottom(true)
-	_errorStyle = lipgloss.NewStyle().Foreground(_errorColor)
+	"github.com/charmbracelet/x/ansi"
 )
 
 type model struct {
 	id    string
 	ready bool
+	// Layers of the view: the grid, and the dialog, help or feedback over it.
+	grid    *layer
+	overlay *layer
+	// Output of the program, also used for escape sequences written outside
+	// of the view.
+	output *terminalOutput
 
-	executor    *multiExecutor
-	count       int
-	rows        int
-	cols        int
-	panes       []modelPane
-	activePane  int
-	allDone     bool
+	executor   *multiExecutor
+	opts       runOpts
+	styles     *styles
+	width      int
+	height     int
+	count      int
+	rows       int
+	cols       int
+	panes      []modelPane
+	activePane int
+	// Whether only the active pane is shown.
+	zoomed  bool
+	allDone bool
+	// Whether an allDoneMsg is pending.
+	waitingForAllDone bool
+	// Whether ticks are running, see tickMsg.
+	ticking     bool
 	terminating bool
 
 	dialogActive bool
 	dialog       dialogModel
-	autoQuit     bool
+	// Transient feedback shown in a dialog box, and a sequence number to
+	// match the message clearing it.
+	feedback    string
+	feedbackSeq int
+	// Whether mouse capture was disabled by the user to allow native text
+	// selection in the terminal.
+	mouseDisabled bool
+	// Help overlay listing all key bindings, and the help footer.
+	helpActive bool
+	help       help.Model
+	// Filter prompt for the active pane, open if filtering.
+	filtering   bool
+	filterInput textinput.Model
+	autoQuit    bool
+	// Last window title set, see updateWindowTitle.
+	windowTitle string
+	failFast    bool
+	// The command whose failure triggered termination in fail-fast mode.
+	abortedBy *Command
 }
 
 type modelPane struct {
 	cmd              *Command
+	styles           *styles
 	printCommandLine bool
 	label            string
 	title            string
-	content          string
+	// LF-terminated lines of output, without the line endings.
+	lines []paneLine
 	// Store the last line of the content separately if it's not terminated by
 	// an LF so that we can support overwriting with CR.
-	lastLine string
+	lastLine paneLine
+	// Rendered rows of the content, i.e. the command line header followed by
+	// wrapped lines, and whether each row is a continuation of the previous
+	// one due to wrapping.
+	rows     []string
+	rowJoins []bool
+	copy     copyMode
+	// Timestamps gutter, toggleable at runtime.
+	showTimestamps  bool
+	timestampFormat string
+	// Lines not matching filter (or matching it if filterInvert) are hidden.
+	filter       *regexp.Regexp
+	filterInvert bool
+	// Highlight rules of the command followed by those of the run, and their
+	// SGR sequences (see highlight.sgr). The number of complete lines matching
+	// each rule is counted as they arrive, and the rules matching the last line
+	// are tracked separately since it may be overwritten.
+	highlights      []highlight
+	highlightStarts []string
+	highlightEnds   []string
+	highlightCounts []int
+	lastLineMatches []bool
+	// Long lines are cut instead of wrapped in no-wrap mode, and scrolled
+	// horizontally by xOffset. contentWidth is the width of the widest line.
+	noWrap       bool
+	xOffset      int
+	contentWidth int
+	// Number of rows of the command line header, and the width of the
+	// timestamps gutter including the separating space, 0 if hidden.
+	headerRows  int
+	gutterWidth int
 	// Viewport width and height.
-	vw, vh int
-	v      viewport.Model
+	vw, vh  int
+	v       viewport.Model
+	started bool
 	// The winsizeCh channel is used to send viewport size changes to the
 	// command executor. It's returned by runCommand().
 	winsizeCh chan<- winsize
-	exited    bool
-	exitCode  int
-	errored   bool
-	err       error
+	// PID of the process once started, and the time the command exited.
+	pid      int
+	endTime  time.Time
+	ready    bool
+	exited   bool
+	exitCode int
+	errored  bool
+	err      error
+	// Set on panes still running when the grid is terminated: cancelled if
+	// due to fail-fast, interrupted if due to the user.
+	cancelled   bool
+	interrupted bool
+	// Set when the command is being stopped or restarted from the pane, and
+	// once it's stopped.
+	stopping   bool
+	restarting bool
+	stopped    bool
+	// Unseen output and bell while the pane is not active.
+	activity bool
+	bell     bool
+	// Time of the last output, whether the command is stalled, and whether
+	// it's terminated due to the stall timeout.
+	lastOutput    time.Time
+	stalled       bool
+	stallTimedOut bool
+	// Last progress extracted from the output, see WithProgress.
+	progress    float64
+	hasProgress bool
+}
+
+type paneLine struct {
+	text string
+	// The text without escape sequences, for filtering, and with highlights
+	// applied, computed once when the line arrives.
+	plain       string
+	highlighted string
+	// Arrival time of the line.
+	time time.Time
 }
 
 type winsize struct {
@@ -83,39 +167,89 @@ type (
 	terminateMsg      struct{}
 )
 
-// cols must be positive, commands must not be empty.
+type feedbackMsg struct {
+	text string
+}
+
+type feedbackClearMsg struct {
+	seq int
+}
+
+type addCommandMsg struct {
+	cmd *Command
+}
+
+type removeCommandMsg struct {
+	cmd *Command
+}
+
+// cols must be positive.
 func newModel(cols int, commands []*Command, opts runOpts) model {
-	count := len(commands)
-	rows := (count + cols - 1) / cols
-	var panes []modelPane
-	for _, c := range commands {
-		pane := modelPane{
-			cmd:              c,
-			printCommandLine: opts.printCommandLine,
-			label:            c.label,
-		}
-		var title string
-		if len(pane.cmd.cmd.Args) > 0 {
-			title = pane.cmd.cmd.Args[0]
-			if c.label != "" && title != c.label {
-				title = fmt.Sprintf("%s (%s)", title, c.label)
-			}
-		} else {
-			title = c.label
-		}
-		pane.title = title
-		panes = append(panes, pane)
-	}
-	return model{
-		id:       zone.NewPrefix(),
-		executor: newMultiExecutor(),
-		count:    count,
-		rows:     rows,
+	output := newTerminalOutput(os.Stdout)
+	styles := newStyles(*opts.theme, opts.border, newRenderer(output, opts.noColorEnv))
+	grid := newLayer()
+	overlay := newLayer()
+	m := model{
+		id:       grid.zones.NewPrefix(),
+		grid:     grid,
+		overlay:  overlay,
+		output:   output,
+		executor: newMultiExecutor(styles.error),
 		cols:     cols,
-		panes:    panes,
-		dialog:   newDialogModel(),
+		styles:   styles,
+		dialog:   newDialogModel(opts.keyMap, styles, overlay),
+		help:     help.New(),
+		opts:     opts,
 		autoQuit: opts.autoQuit,
+		failFast: opts.failFast,
 	}
+	for _, c := range commands {
+		m.panes = append(m.panes, m.newPane(c))
+	}
+	m.count = len(m.panes)
+	return m
+}
+
+func (m model) newPane(c *Command) modelPane {
+	pane := modelPane{
+		cmd:              c,
+		styles:           m.styles,
+		printCommandLine: m.opts.printCommandLine,
+		label:            c.label,
+		timestampFormat:  c.timestampFormat,
+		filter:           c.filter,
+		filterInvert:     c.filterInvert,
+		highlights:       slices.Concat(c.highlights, m.opts.highlights),
+		noWrap:           c.noWrap || m.opts.noWrap,
+	}
+	pane.highlightStarts = make([]string, len(pane.highlights))
+	pane.highlightEnds = make([]string, len(pane.highlights))
+	for i, h := range pane.highlights {
+		h.style = h.style.Renderer(m.styles.renderer)
+		pane.highlights[i] = h
+		pane.highlightStarts[i], pane.highlightEnds[i] = h.sgr()
+	}
+	pane.highlightCounts = make([]int, len(pane.highlights))
+	pane.lastLineMatches = make([]bool, len(pane.highlights))
+	if pane.timestampFormat == "" {
+		pane.timestampFormat = m.opts.timestampFormat
+	}
+	if pane.timestampFormat != "" {
+		pane.showTimestamps = true
+	} else {
+		pane.timestampFormat = _defaultTimestampFormat
+	}
+	var title string
+	if len(pane.cmd.cmd.Args) > 0 {
+		title = pane.cmd.cmd.Args[0]
+		if c.label != "" && title != c.label {
+			title = fmt.Sprintf("%s (%s)", title, c.label)
+		}
+	} else {
+		title = c.label
+	}
+	pane.title = title
+	return pane
 }
 
 func (m model) Init() tea.Cmd {
@@ -130,57 +264,69 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	ret := func() (model, tea.Cmd) { return m, tea.Batch(cmds...) }
 
 	setWindowTitle := func() {
-		addCmd(m.setWindowTitleToActivePane())
+		addCmd(m.updateWindowTitle())
 	}
 	setActivePane := func(idx int) {
+		changed := idx != m.activePane
 		m.activePane = idx
+		m.panes[idx].activity = false
+		m.panes[idx].bell = false
+		if m.zoomed && changed {
+			addCmd(m.layout())
+		}
 		setWindowTitle()
 	}
 
 	switch msg := msg.(type) {
 	case tea.WindowSizeMsg:
-		w := msg.Width / m.cols
-		wRem := msg.Width % m.cols
-		h := msg.Height / m.rows
-		hRem := msg.Height % m.rows
-		for row := 0; row < m.rows; row++ {
-			for col := 0; col < m.cols; col++ {
-				idx := row*m.cols + col
-				if idx >= m.count {
-					break
-				}
-				vw := w - 1
-				if col < wRem {
-					vw++
-				}
-				vh := h - 1
-				if row < hRem {
-					vh++
-				}
-				pane := &m.panes[idx]
-				if !m.ready {
-					// Run command on first WindowSizeMsg.
-					pane.winsizeCh, cmd = m.executor.runCommand(idx, vw, vh, pane.cmd)
-					addCmd(cmd)
-				} else {
-					// Resize command pty on subsequent WindowSizeMsgs.
-					if !pane.exited && !pane.errored {
-						go func() {
-							pane.winsizeCh <- winsize{vw, vh}
-						}()
-					}
-				}
-				pane.vw = vw
-				pane.vh = vh
-				pane.v = viewport.New(vw, vh)
-				pane.refreshContent()
-				pane.v.GotoBottom()
-			}
-		}
+		m.width = msg.Width
+		m.height = msg.Height
+		addCmd(m.layout())
 		if !m.ready {
 			setWindowTitle()
-			addCmd(m.executor.waitForAllDone)
+			addCmd(m.waitForAllDone())
 			m.ready = true
+			addCmd(m.startTicking())
+		}
+		return ret()
+
+	case addCommandMsg:
+		if m.terminating || m.paneIndex(msg.cmd) >= 0 {
+			return ret()
+		}
+		m.panes = append(m.panes, m.newPane(msg.cmd))
+		m.count = len(m.panes)
+		if !m.ready {
+			// The command will be started on the first WindowSizeMsg.
+			return ret()
+		}
+		addCmd(m.layout())
+		addCmd(m.startTicking())
+		if m.allDone {
+			// Rearm the all-done accounting, and dismiss the "All done" dialog.
+			m.allDone = false
+			m.dialogActive = false
+			addCmd(m.waitForAllDone())
+		}
+		return ret()
+
+	case removeCommandMsg:
+		idx := m.paneIndex(msg.cmd)
+		if m.terminating || idx < 0 {
+			return ret()
+		}
+		m.executor.remove(msg.cmd)
+		if idx == m.activePane {
+			m.filtering = false
+		}
+		m.panes = slices.Delete(m.panes, idx, idx+1)
+		m.count = len(m.panes)
+		if idx < m.activePane || m.activePane >= m.count {
+			m.activePane = max(m.activePane-1, 0)
+		}
+		if m.ready {
+			addCmd(m.layout())
+			setWindowTitle()
 		}
 		return ret()
 
@@ -190,30 +336,180 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			addCmd(cmd)
 			break
 		}
-		switch msg.String() {
-		case "ctrl+c", "q", "esc":
+		km := m.opts.keyMap
+		interrupt := key.Matches(msg, km.Interrupt)
+		if m.helpActive {
+			if interrupt {
+				addCmd(openExitDialog())
+			}
+			if interrupt || key.Matches(msg, km.Help, km.Quit) {
+				m.helpActive = false
+			}
+			return ret()
+		}
+		if m.filtering && !interrupt {
+			done, cmd := m.panes[m.activePane].updateFilterPrompt(km, &m.filterInput, msg)
+			m.filtering = !done
+			addCmd(cmd)
+			return ret()
+		}
+		if m.count > 0 && m.panes[m.activePane].copy.active && !interrupt {
+			if text, ok := m.panes[m.activePane].updateCopyMode(km, msg); ok {
+				addCmd(copyToClipboard(m.output, text))
+			}
+			return ret()
+		}
+		switch {
+		case interrupt, key.Matches(msg, km.Quit):
 			addCmd(openExitDialog())
 			return ret()
-		case "tab":
-			setActivePane((m.activePane + 1) % m.count)
+		case key.Matches(msg, km.Help):
+			m.helpActive = true
+			return ret()
+		case key.Matches(msg, km.NextPane):
+			if m.count > 0 {
+				setActivePane((m.activePane + 1) % m.count)
+			}
+			return ret()
+		case key.Matches(msg, km.PrevPane):
+			if m.count > 0 {
+				setActivePane((m.activePane - 1 + m.count) % m.count)
+			}
+			return ret()
+		case key.Matches(msg, km.NextActivity):
+			if idx := m.nextActivePane(); idx >= 0 {
+				setActivePane(idx)
+			} else {
+				addCmd(showFeedback("No panes with activity."))
+			}
+			return ret()
+		case key.Matches(msg, km.GotoTop):
+			if m.count > 0 {
+				m.panes[m.activePane].v.GotoTop()
+			}
+			return ret()
+		case key.Matches(msg, km.GotoBottom):
+			if m.count > 0 {
+				m.panes[m.activePane].v.GotoBottom()
+			}
+			return ret()
+		case key.Matches(msg, km.CopyMode):
+			if m.count > 0 {
+				m.panes[m.activePane].enterCopyMode()
+			}
+			return ret()
+		case key.Matches(msg, km.ToggleMouse):
+			m.mouseDisabled = !m.mouseDisabled
+			if m.mouseDisabled {
+				addCmd(tea.DisableMouse)
+				addCmd(showFeedback(fmt.Sprintf("Mouse capture disabled, press %s to enable.", km.ToggleMouse.Help().Key)))
+			} else {
+				addCmd(tea.EnableMouseCellMotion)
+				addCmd(showFeedback("Mouse capture enabled."))
+			}
+			return ret()
+		case key.Matches(msg, km.ToggleTimestamps):
+			if m.count > 0 {
+				pane := &m.panes[m.activePane]
+				pane.showTimestamps = !pane.showTimestamps
+				atBottom := pane.v.AtBottom()
+				pane.refreshContent()
+				if atBottom {
+					pane.v.GotoBottom()
+				}
+			}
+			return ret()
+		case key.Matches(msg, km.ToggleWrap):
+			if m.count > 0 {
+				m.panes[m.activePane].toggleWrap()
+			}
+			return ret()
+		case key.Matches(msg, km.ScrollLeft):
+			if m.count > 0 {
+				m.panes[m.activePane].scrollHorizontally(-_horizontalScrollStep)
+			}
+			return ret()
+		case key.Matches(msg, km.ScrollRight):
+			if m.count > 0 {
+				m.panes[m.activePane].scrollHorizontally(_horizontalScrollStep)
+			}
+			return ret()
+		case key.Matches(msg, km.Filter):
+			if m.count > 0 {
+				m.filtering = true
+				m.filterInput = newFilterInput(&m.panes[m.activePane])
+			}
+			return ret()
+		case key.Matches(msg, km.Pager):
+			if m.count > 0 {
+				addCmd(m.panes[m.activePane].openInPager())
+			}
+			return ret()
+		case key.Matches(msg, km.Zoom):
+			addCmd(m.toggleZoom())
 			return ret()
-		case "shift+tab":
-			setActivePane((m.activePane - 1 + m.count) % m.count)
+		case key.Matches(msg, km.Restart):
+			if m.count > 0 {
+				addCmd(m.restartPane(m.activePane))
+			}
+			return ret()
+		case key.Matches(msg, km.Stop):
+			if m.count > 0 {
+				addCmd(m.stopPane(m.activePane))
+			}
+			return ret()
+		case key.Matches(msg, km.Save):
+			if m.count > 0 {
+				path, err := m.panes[m.activePane].saveToFile()
+				if err != nil {
+					addCmd(showFeedback(fmt.Sprintf("Error: %s", err)))
+				} else {
+					addCmd(showFeedback(fmt.Sprintf("Saved to %s", path)))
+				}
+			}
 			return ret()
 		}
 
+	case pagerDoneMsg:
+		if msg.err != nil {
+			addCmd(showFeedback(fmt.Sprintf("Pager error: %s", msg.err)))
+		}
+		return ret()
+
 	case tea.MouseMsg:
-		if m.blocked() {
+		if m.dialogActive && !m.terminating {
+			m.dialog, cmd = m.dialog.Update(msg)
+			addCmd(cmd)
 			break
 		}
+		if m.terminating || m.filtering {
+			break
+		}
+		if delta := horizontalWheelDelta(msg); delta != 0 && m.count > 0 && m.panes[m.activePane].noWrap {
+			m.panes[m.activePane].scrollHorizontally(delta)
+			return ret()
+		}
 		if msg.Action != tea.MouseActionRelease || msg.Button != tea.MouseButtonLeft {
 			break
 		}
+		if m.overlay.covers(msg) {
+			// Don't click through the help overlay or feedback.
+			return ret()
+		}
 		for idx := 0; idx < m.count; idx++ {
-			if zone.Get(m.paneId(idx)).InBounds(msg) {
-				setActivePane(idx)
-				return ret()
+			if !m.grid.inBounds(m.paneId(idx), msg) {
+				continue
+			}
+			setActivePane(idx)
+			switch m.clickedControl(idx, msg) {
+			case _restartControl:
+				addCmd(m.restartPane(idx))
+			case _zoomControl:
+				addCmd(m.toggleZoom())
+			case _stopControl:
+				addCmd(m.stopPane(idx))
 			}
+			return ret()
 		}
 
 	case cmdOutputMsg:
@@ -222,37 +518,126 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		})
 
 		line := string(msg.line)
+		idx := m.paneIndex(msg.cmd)
+		if len(line) == 0 || idx < 0 {
+			break
+		}
+		line, bell := stripBells(line)
+		if bell && m.opts.forwardBell {
+			addCmd(ringBell(m.output))
+		}
+		m.markActivity(idx, bell)
+		pane := &m.panes[idx]
+		pane.lastOutput = msg.time
+		if pane.stalled {
+			pane.stalled = false
+			m.emit(EventResumed, pane.cmd)
+		}
 		if len(line) == 0 {
 			break
 		}
-		pane := &m.panes[msg.paneIdx]
+		pane.updateProgress(line)
+		setWindowTitle()
 		switch line[len(line)-1] {
 		case '\n':
-			pane.lastLine = ""
-			pane.content += line
+			pane.setLastLine("", time.Time{})
+			pane.appendLine(line[:len(line)-1], msg.time)
 		case '\r':
-			pane.lastLine = line[:len(line)-1]
+			pane.setLastLine(line[:len(line)-1], msg.time)
 		default:
 			// This shouldn't happen, but just in case.
-			pane.lastLine += line
+			pane.setLastLine(pane.lastLine.text+line, msg.time)
 		}
 		atBottom := pane.v.AtBottom()
 		pane.refreshContent()
-		// Only auto-scroll if the viewport was already at the bottom.
-		if atBottom {
+		// Only auto-scroll if the viewport was already at the bottom, and
+		// not in copy mode.
+		if atBottom && !pane.copy.active {
 			pane.v.GotoBottom()
 		}
 		return ret()
 
+	case cmdStartedMsg:
+		addCmd(next(msg.ch))
+		if idx := m.paneIndex(msg.cmd); idx >= 0 {
+			m.panes[idx].pid = msg.pid
+		}
+		return ret()
+
+	case cmdStoppedMsg:
+		idx := m.paneIndex(msg.cmd)
+		if idx < 0 || m.terminating {
+			return ret()
+		}
+		pane := &m.panes[idx]
+		if msg.restart {
+			addCmd(m.restartedPane(idx))
+			return ret()
+		}
+		pane.stopping = false
+		if pane.running() {
+			pane.stopped = true
+			pane.endTime = time.Now()
+		}
+		if pane.stallTimedOut {
+			pane.cmd.err = stallTimeoutError(pane.cmd)
+			if m.failFast && !pane.cmd.allowFailure {
+				m.abortedBy = pane.cmd
+				addCmd(terminate())
+			}
+		}
+		return ret()
+
+	case tickMsg:
+		// Durations are updated as the view is re-rendered with the current
+		// time. Nothing changes once all commands are done, until a command
+		// is added or restarted.
+		if m.allDone {
+			m.ticking = false
+			return ret()
+		}
+		addCmd(m.checkStalls())
+		addCmd(tick())
+		return ret()
+
+	case cmdReadyMsg:
+		addCmd(next(msg.ch))
+		if idx := m.paneIndex(msg.cmd); idx >= 0 {
+			m.panes[idx].ready = true
+			m.emit(EventReady, msg.cmd)
+		}
+		return ret()
+
 	case cmdExitMsg:
-		pane := &m.panes[msg.paneIdx]
+		idx := m.paneIndex(msg.cmd)
+		if idx < 0 {
+			return ret()
+		}
+		pane := &m.panes[idx]
+		pane.endTime = time.Now()
 		pane.exited = msg.exited
 		pane.exitCode = msg.exitCode
 		pane.errored = msg.errored
 		pane.err = msg.err
+		failed := msg.errored || !pane.cmd.isSuccessExitCode(msg.exitCode)
+		setWindowTitle()
+		if m.failFast && !m.terminating && failed && !pane.cmd.allowFailure {
+			m.abortedBy = pane.cmd
+			addCmd(terminate())
+		}
 		return ret()
 
 	case allDoneMsg:
+		m.waitingForAllDone = false
+		if slices.ContainsFunc(m.panes, func(p modelPane) bool { return p.restarting }) {
+			// Waiting is resumed once the command is restarted.
+			return ret()
+		}
+		if !m.executor.idle() {
+			// More commands were added while the message was in flight.
+			addCmd(m.waitForAllDone())
+			return ret()
+		}
 		if m.autoQuit {
 			return m, tea.Quit
 		}
@@ -274,21 +659,64 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.dialog.selected = 0
 		return ret()
 
+	case feedbackMsg:
+		m.feedback = msg.text
+		m.feedbackSeq++
+		seq := m.feedbackSeq
+		addCmd(tea.Tick(_feedbackDuration, func(time.Time) tea.Msg {
+			return feedbackClearMsg{seq}
+		}))
+		return ret()
+
+	case feedbackClearMsg:
+		if msg.seq == m.feedbackSeq {
+			m.feedback = ""
+		}
+		return ret()
+
 	case dialogCloseMsg:
 		m.dialogActive = false
 		return ret()
 
 	case terminateMsg:
+		if m.terminating {
+			return ret()
+		}
 		m.dialogActive = false
 		m.terminating = true
+		for i := range m.panes {
+			pane := &m.panes[i]
+			if pane.exited || pane.errored || pane.stopped {
+				continue
+			}
+			if m.abortedBy != nil {
+				pane.cancelled = true
+				pane.cmd.cancelled = true
+			} else {
+				pane.interrupted = true
+			}
+		}
 		addCmd(m.executor.terminateAll)
 		return ret()
 
 	case allTerminatedMsg:
+		// Panes of terminated commands get no cmdExitMsg; record when their
+		// commands were done for the final view, like Command.Duration().
+		for i := range m.panes {
+			pane := &m.panes[i]
+			if !pane.endTime.IsZero() || !pane.started {
+				continue
+			}
+			pane.endTime = pane.cmd.endTime
+			if pane.endTime.IsZero() {
+				// The command is somehow stuck even after SIGKILL.
+				pane.endTime = time.Now()
+			}
+		}
 		return m, tea.Quit
 	}
 
-	if !m.dialogActive {
+	if !m.dialogActive && m.count > 0 {
 		// Handle keyboard and mouse events in the viewport.
 		m.panes[m.activePane].v, cmd = m.panes[m.activePane].v.Update(msg)
 		addCmd(cmd)
@@ -302,67 +730,22 @@ func (m model) View() string {
 		return ""
 	}
 	var rowBlocks []string
-	for row := 0; row < m.rows; row++ {
-		var blocks []string
-		for col := 0; col < m.cols; col++ {
-			idx := row*m.cols + col
-			if idx >= m.count {
-				break
-			}
-			pane := m.panes[idx]
-			v := pane.v
-			isActive := idx == m.activePane
-
-			var style lipgloss.Style
-			if isActive {
-				style = _activePaneStyle
-			} else {
-				style = _inactivePaneStyle
-			}
-			block := style.Render(v.View())
-			w, h := lipgloss.Size(block)
-
-			styleOverlay := func(s string) string {
-				if isActive {
-					return _activeOverlayStyle.Render(s)
-				}
-				return _inactiveOverlayStyle.Render(s)
-			}
-
-			// Overlay label in bottom center.
-			if pane.label != "" {
-				label := pane.label
-				if len(label) > w-2 {
-					label = label[:w-2]
-				}
-				labelOverlay := styleOverlay(" " + label + " ")
-				block = placeOverlay((w-lipgloss.Width(labelOverlay))/2, h-1, labelOverlay, block)
-			}
-
-			// Overlay exit status or error in the bottom left corner.
-			var exitOverlay string
-			if pane.errored {
-				exitOverlay = _errorStyle.Render("ERROR ")
-			} else if pane.exited {
-				code := pane.exitCode
-				s := fmt.Sprintf("EXIT %d ", code)
-				if code == 0 {
-					exitOverlay = styleOverlay(s)
-				} else {
-					exitOverlay = _errorStyle.Render(s)
+	if m.zoomed && m.count > 0 {
+		rowBlocks = append(rowBlocks, m.paneView(m.activePane))
+	} else {
+		for row := 0; row < m.rows; row++ {
+			var blocks []string
+			for col := 0; col < m.cols; col++ {
+				idx := row*m.cols + col
+				if idx >= m.count {
+					break
 				}
+				blocks = append(blocks, m.paneView(idx))
 			}
-			block = placeOverlay(0, h-1, exitOverlay, block)
-
-			// Overlay scroll percentage in bottom right corner.
-			scrollOverlay := styleOverlay(fmt.Sprintf(" %.0f%% ", v.ScrollPercent()*100))
-			block = placeOverlay(w-lipgloss.Width(scrollOverlay)-1, h-1, scrollOverlay, block)
-
-			blocks = append(blocks, zone.Mark(m.paneId(idx), block))
+			rowBlocks = append(rowBlocks, lipgloss.JoinHorizontal(lipgloss.Top, blocks...))
 		}
-		rowBlocks = append(rowBlocks, lipgloss.JoinHorizontal(lipgloss.Top, blocks...))
 	}
-	view := lipgloss.JoinVertical(lipgloss.Left, rowBlocks...)
+	view := m.grid.scan(0, 0, lipgloss.JoinVertical(lipgloss.Left, rowBlocks...))
 	vw, vh := lipgloss.Size(view)
 
 	// Render dialog.
@@ -371,55 +754,351 @@ func (m model) View() string {
 		dialogView = m.dialog.View()
 	}
 	if m.terminating {
-		dialogView = dialogFeedbackView("Terminating...")
+		dialogView = m.dialog.feedbackView("Terminating...")
+	}
+	if dialogView == "" && m.helpActive {
+		dialogView = m.helpView()
+	}
+	if dialogView == "" && m.feedback != "" {
+		dialogView = m.dialog.feedbackView(m.feedback)
 	}
 	if dialogView != "" {
 		dw, dh := lipgloss.Size(dialogView)
-		dx := (vw - dw) / 2
-		if dx < 0 {
-			dx = 0
-		}
-		dy := (vh - dh) / 2
-		if dy < 0 {
-			dy = 0
-		}
-		// TODO: support mouse events in the dialog.
-		//
-		// The PlaceOverlay() code seems overly simplistic and destroys zone markers
-		// in the overlay and may or may not fuck up markers elsewhere, so we
-		// probably have to wait for proper compositing support.
-		//
-		// See
-		// - https://github.com/charmbracelet/lipgloss/issues/65
-		// - https://github.com/charmbracelet/lipgloss/pull/102
-		// - https://github.com/charmbracelet/bubbletea/issues/79
-		view = placeOverlay(dx, dy, dialogView, view)
-	}
-
-	return zone.Scan(view)
+		dx := clamp((vw-dw)/2, 0, max(vw-dw, 0))
+		dy := clamp((vh-dh)/2, 0, max(vh-dh, 0))
+		// The dialog is a layer of its own so that its zones, e.g. buttons,
+		// survive being composited over the grid.
+		view = placeOverlay(dx, dy, m.overlay.scan(dx, dy, dialogView), view)
+	} else {
+		m.overlay.hide()
+	}
+	if m.opts.helpFooter {
+		view = lipgloss.JoinVertical(lipgloss.Left, view, m.helpFooterView())
+	}
+
+	return view
+}
+
+// paneView renders pane idx with its border and the overlays in it.
+func (m model) paneView(idx int) string {
+	pane := m.panes[idx]
+	v := pane.v
+	isActive := idx == m.activePane
+
+	var style lipgloss.Style
+	switch {
+	case isActive:
+		style = m.styles.activePane
+	case pane.activity || pane.bell:
+		style = m.styles.activityPane
+	default:
+		style = m.styles.inactivePane
+	}
+	block := style.Render(v.View())
+	w, h := lipgloss.Size(block)
+
+	styleOverlay := func(s string) string {
+		if isActive {
+			return m.styles.activeOverlay.Render(s)
+		}
+		return m.styles.inactiveOverlay.Render(s)
+	}
+
+	// Leave the bottom left corner of full borders alone.
+	left := 0
+	if m.opts.border != BorderMinimal {
+		left = 1
+		// Overlay title, PID and running duration in the top border.
+		top := styleOverlay(pane.topBorderText(w - 4))
+		block = placeOverlay(2, 0, top, block)
+	}
+
+	// Overlay label in bottom center.
+	if pane.label != "" {
+		label := pane.label
+		if len(label) > w-2 {
+			label = label[:w-2]
+		}
+		labelOverlay := styleOverlay(" " + label + " ")
+		block = placeOverlay((w-lipgloss.Width(labelOverlay))/2, h-1, labelOverlay, block)
+	}
+
+	// Overlay exit status, error or readiness in the bottom left corner.
+	// Failures are shown in yellow instead of red if allowed.
+	failureStyle := m.styles.error
+	if pane.cmd.allowFailure {
+		failureStyle = m.styles.warning
+	}
+	var exitOverlay string
+	if pane.errored {
+		exitOverlay = failureStyle.Render("ERROR ")
+	} else if pane.exited {
+		code := pane.exitCode
+		s := fmt.Sprintf("EXIT %d ", code)
+		if pane.cmd.isSuccessExitCode(code) {
+			exitOverlay = m.styles.success.Render(s)
+		} else {
+			exitOverlay = failureStyle.Render(s)
+		}
+	} else if pane.restarting {
+		exitOverlay = styleOverlay("RESTARTING ")
+	} else if pane.stallTimedOut {
+		exitOverlay = failureStyle.Render("TIMED OUT ")
+	} else if pane.stopped {
+		exitOverlay = styleOverlay("STOPPED ")
+	} else if pane.stopping {
+		exitOverlay = styleOverlay("STOPPING ")
+	} else if pane.cancelled {
+		exitOverlay = styleOverlay("CANCELLED ")
+	} else if pane.interrupted {
+		exitOverlay = styleOverlay("INTERRUPTED ")
+	} else if pane.stalled {
+		exitOverlay = m.styles.warning.Render(fmt.Sprintf("STALLED %s ", formatDuration(pane.sinceOutput())))
+	} else if len(pane.cmd.probes) > 0 {
+		if pane.ready {
+			exitOverlay = m.styles.success.Render("READY ")
+		} else {
+			exitOverlay = styleOverlay("STARTING ")
+		}
+	}
+	// With the minimal border, the running duration follows the exit status
+	// since there's no top border to show it.
+	if d := pane.elapsed(); d != "" && m.opts.border == BorderMinimal {
+		exitOverlay += styleOverlay(d + " ")
+	}
+	block = placeOverlay(left, h-1, exitOverlay, block)
+
+	// Overlay the activity flags and the number of lines matching each
+	// highlight rule next to the exit status.
+	flags := pane.activityFlags(styleOverlay)
+	block = placeOverlay(left+lipgloss.Width(exitOverlay), h-1, flags, block)
+	progressX := left + lipgloss.Width(exitOverlay) + lipgloss.Width(flags)
+	if badge := pane.highlightBadge(); badge != "" {
+		block = placeOverlay(progressX, h-1, badge, block)
+		progressX += lipgloss.Width(badge)
+	}
+
+	// Overlay scroll percentage in bottom right corner, or the cursor
+	// position in copy mode.
+	scrollOverlay := styleOverlay(fmt.Sprintf(" %.0f%% ", v.ScrollPercent()*100))
+	if pane.copy.active {
+		scrollOverlay = m.styles.activeOverlay.Render(fmt.Sprintf(" COPY %d/%d ", pane.copy.row+1, len(pane.rows)))
+	}
+	block = placeOverlay(w-lipgloss.Width(scrollOverlay)-1, h-1, scrollOverlay, block)
+	right := w - lipgloss.Width(scrollOverlay) - 1
+
+	// Overlay the horizontal offset in no-wrap mode to the left of it.
+	if indicator := pane.xOffsetIndicator(); indicator != "" {
+		xOffsetOverlay := styleOverlay(" " + indicator)
+		right -= lipgloss.Width(xOffsetOverlay)
+		block = placeOverlay(max(right, 0), h-1, xOffsetOverlay, block)
+	}
+
+	// Overlay the controls to the left of the scroll percentage, and the
+	// filter to the left of them, or the filter prompt over the whole bottom
+	// border while it's open. The controls are placed last since placeOverlay
+	// drops zone markers in the background it covers.
+	controlsOverlay := m.controlsView(idx, styleOverlay)
+	controlsX := right - lipgloss.Width(controlsOverlay)
+	if isActive && m.filtering {
+		block = placeOverlay(left, h-1, ansi.Truncate(m.filterInput.View()+" ", w-1-left, ""), block)
+	} else {
+		filterX := controlsX
+		if pane.filter != nil {
+			filterOverlay := styleOverlay(ansi.Truncate(" /"+pane.filterString()+" ", max(w/3, 4), "… "))
+			filterX -= lipgloss.Width(filterOverlay)
+			block = placeOverlay(max(filterX, 0), h-1, filterOverlay, block)
+		}
+		// Overlay the progress bar in the space left after the status.
+		if bar := pane.progressBar(filterX-progressX, styleOverlay); bar != "" {
+			block = placeOverlay(progressX, h-1, bar, block)
+		}
+		block = placeOverlay(max(controlsX, 0), h-1, controlsOverlay, block)
+	}
+
+	return m.grid.mark(m.paneId(idx), block)
+}
+
+// waitForAllDone returns a command waiting for all commands to be done, see
+// multiExecutor.waitForAllDone.
+func (m *model) waitForAllDone() tea.Cmd {
+	m.waitingForAllDone = true
+	return m.executor.waitForAllDone
 }
 
 func (m model) blocked() bool {
 	return m.dialogActive || m.terminating
 }
 
-func (m model) setWindowTitleToActivePane() tea.Cmd {
-	return tea.SetWindowTitle(m.panes[m.activePane].title)
+// updateWindowTitle returns a command setting the window title to the title of
+// the active pane, prefixed with the overall progress of the commands if any
+// (see WithProgress), or nil if the title is unchanged.
+func (m *model) updateWindowTitle() tea.Cmd {
+	var title string
+	if m.count > 0 {
+		title = m.panes[m.activePane].title
+		if progress, ok := m.overallProgress(); ok {
+			title = fmt.Sprintf("[%.0f%%] %s", progress*100, title)
+		}
+	}
+	if title == m.windowTitle {
+		return nil
+	}
+	m.windowTitle = title
+	return tea.SetWindowTitle(title)
+}
+
+// layout computes the size of each pane from the window size, or the size of
+// the whole window for the active pane if zoomed, starting the commands of panes
+// that haven't been started yet and resizing the ptys of the rest.
+func (m *model) layout() tea.Cmd {
+	var cmds []tea.Cmd
+	m.rows = max((m.count+m.cols-1)/m.cols, 1)
+	w := m.width / m.cols
+	wRem := m.width % m.cols
+	height := m.height
+	if m.opts.helpFooter {
+		height--
+	}
+	h := height / m.rows
+	hRem := height % m.rows
+	frameStyle := paneStyle(m.styles.renderer, m.opts.border)
+	for idx := range m.panes {
+		row := idx / m.cols
+		col := idx % m.cols
+		vw := max(w-frameStyle.GetHorizontalFrameSize(), 1)
+		if col < wRem {
+			vw++
+		}
+		vh := max(h-frameStyle.GetVerticalFrameSize(), 1)
+		if row < hRem {
+			vh++
+		}
+		if m.zoomed && idx == m.activePane {
+			vw = max(m.width-frameStyle.GetHorizontalFrameSize(), 1)
+			vh = max(height-frameStyle.GetVerticalFrameSize(), 1)
+		}
+		pane := &m.panes[idx]
+		if !pane.started {
+			pane.started = true
+			var cmd tea.Cmd
+			pane.winsizeCh, cmd = m.executor.runCommand(pane.cmd, vw, vh)
+			cmds = append(cmds, cmd)
+		} else if pane.winsizeCh != nil && !pane.exited && !pane.errored {
+			// Resize command pty if the size changed.
+			if vw != pane.vw || vh != pane.vh {
+				winsizeCh := pane.winsizeCh
+				go func() {
+					winsizeCh <- winsize{vw, vh}
+				}()
+			}
+		}
+		if vw == pane.vw && vh == pane.vh {
+			// Keep the scroll position.
+			continue
+		}
+		pane.vw = vw
+		pane.vh = vh
+		pane.v = viewport.New(vw, vh)
+		pane.v.KeyMap = m.opts.keyMap.viewportKeyMap()
+		pane.refreshContent()
+		pane.v.GotoBottom()
+	}
+	return tea.Batch(cmds...)
+}
+
+// commands returns the commands of all panes in order.
+func (m model) commands() []*Command {
+	var commands []*Command
+	for _, pane := range m.panes {
+		commands = append(commands, pane.cmd)
+	}
+	return commands
+}
+
+// paneIndex returns the index of the pane running cmd, or -1 if there's no
+// such pane (e.g. it has been removed).
+func (m model) paneIndex(cmd *Command) int {
+	return slices.IndexFunc(m.panes, func(p modelPane) bool { return p.cmd == cmd })
 }
 
 func (m model) finalView() string {
 	m.dialogActive = false
 	m.terminating = false
+	m.helpActive = false
+	m.opts.helpFooter = false
 	return m.View()
 }
 
 func (p *modelPane) refreshContent() {
 	var header string
 	if p.printCommandLine {
-		header = _commandStyle.Width(p.vw).Render(p.cmd.cmdline)
+		header = p.styles.command.Width(p.vw).Render(p.cmd.cmdline)
 	}
-	content := wrap.String(p.content+p.lastLine, p.vw)
-	p.v.SetContent(lipgloss.JoinVertical(lipgloss.Left, header, content))
+	rows := strings.Split(header, "\n")
+	joins := make([]bool, len(rows))
+	p.headerRows = len(rows)
+	p.contentWidth = 0
+	lines := append(p.lines[:len(p.lines):len(p.lines)], p.lastLine)
+
+	// Timestamps are rendered in a gutter to the left of the content, on the
+	// first row of each wrapped line.
+	width := p.vw
+	var gutters []string
+	var gutterWidth int
+	p.gutterWidth = 0
+	if p.showTimestamps {
+		gutters = make([]string, len(lines))
+		for i, l := range lines {
+			if l.time.IsZero() {
+				continue
+			}
+			gutters[i] = p.formatTimestamp(l.time)
+			gutterWidth = max(gutterWidth, lipgloss.Width(gutters[i]))
+		}
+		width = max(width-gutterWidth-1, 1)
+		p.gutterWidth = gutterWidth + 1
+	}
+	for i, l := range lines {
+		if p.hidden(l) {
+			continue
+		}
+		for j, row := range p.wrapLine(l.highlighted, width) {
+			if gutters != nil {
+				var gutter string
+				if j == 0 {
+					gutter = gutters[i]
+				}
+				row = p.styles.timestamp.Width(gutterWidth+1).Render(gutter) + row
+			}
+			rows = append(rows, row)
+			joins = append(joins, j > 0)
+		}
+	}
+	p.rows = rows
+	p.rowJoins = joins
+	p.xOffset = clamp(p.xOffset, 0, p.maxXOffset())
+	p.setContent()
+}
+
+// setContent sets the rendered rows as the content of the viewport, decorated
+// with the cursor and selection in copy mode, and cut in no-wrap mode.
+func (p *modelPane) setContent() {
+	if p.copy.active {
+		p.clampCopyCursor()
+		p.v.SetContent(p.cutContent(p.copyModeContent()))
+		return
+	}
+	p.v.SetContent(p.cutContent(strings.Join(p.rows, "\n")))
+}
+
+// formatTimestamp formats the arrival time of a line for the timestamps
+// gutter.
+func (p *modelPane) formatTimestamp(t time.Time) string {
+	if p.timestampFormat == TimestampElapsed {
+		return fmt.Sprintf("+%.1fs", t.Sub(p.cmd.startTime).Seconds())
+	}
+	return t.Format(p.timestampFormat)
 }
 
 func openExitDialog() tea.Cmd {
@@ -434,6 +1113,14 @@ func closeDialog() tea.Cmd {
 	}
 }
 
+// showFeedback returns a command that shows text in a feedback dialog for a
+// short while.
+func showFeedback(text string) tea.Cmd {
+	return func() tea.Msg {
+		return feedbackMsg{text}
+	}
+}
+
 func terminate() tea.Cmd {
 	return func() tea.Msg {
 		return terminateMsg{}
@@ -6,10 +6,11 @@ package mrun
 import (
 	"errors"
 	"fmt"
+	"os"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/x/ansi"
-	zone "github.com/lrstanley/bubblezone"
 )
 
 type runOpts struct {
@@ -17,6 +18,18 @@ type runOpts struct {
 	printCommandLine bool
 	autoQuit         bool
 	printFinalView   bool
+	failFast         bool
+	timestampFormat  string
+	highlights       []highlight
+	keyMap           KeyMap
+	helpFooter       bool
+	theme            *Theme
+	border           PaneBorder
+	noWrap           bool
+	forwardBell      bool
+	eventHandler     func(Event)
+	// Set if NoColorTheme is used due to NO_COLOR.
+	noColorEnv bool
 }
 
 type RunOption func(*runOpts)
@@ -53,17 +66,62 @@ func WithFinalView() RunOption {
 	}
 }
 
+// TimestampElapsed is a special format for [WithTimestamps] and
+// [WithCommandTimestamps] that shows the time elapsed since the command was
+// started, e.g. "+12.3s", instead of the time of day.
+const TimestampElapsed = "elapsed"
+
+// Format of timestamps toggled on at runtime for panes without a configured
+// format.
+const _defaultTimestampFormat = time.TimeOnly
+
+// WithTimestamps shows the arrival time of each line of output in a gutter to
+// the left of the output of every pane. format is a layout for [time.Time.Format],
+// or [TimestampElapsed]. The gutter can be toggled at runtime with the t key.
+//
+// Use [WithCommandTimestamps] to set the format for individual commands.
+func WithTimestamps(format string) RunOption {
+	return func(o *runOpts) {
+		o.timestampFormat = format
+	}
+}
+
+// WithFailFast terminates all running commands as soon as one command fails,
+// i.e. exits with an unsuccessful status (see [WithSuccessExitCodes]) or cannot
+// be run. Commands marked with [WithAllowFailure] never trigger the abort. The
+// terminated commands are marked as cancelled (see [Command.Cancelled]), and
+// Run returns a [*FailFastError] identifying the command that caused the abort.
+func WithFailFast() RunOption {
+	return func(o *runOpts) {
+		o.failFast = true
+	}
+}
+
+// FailFastError is returned by [Run] when the commands were aborted in
+// fail-fast mode (see [WithFailFast]).
+type FailFastError struct {
+	// The command whose failure caused the abort.
+	Command *Command
+}
+
+func (e *FailFastError) Error() string {
+	return fmt.Sprintf("aborted due to failure of %s", e.Command.CommandLine())
+}
+
 // Run runs the given commands simultaneously in a TUI grid.
 //
 // Return values are:
 //   - Slice of commands, now with checkable Err() and ProcessState().
 //   - allSuccessful, only true if all commands ran to completion and exited with
-//     0 (if the user prematurely quit, this will be false even if the terminated
-//     commands responded with exit status 0 on SIGINT/SIGTERM). If it's false,
-//     use Err() or ProcessState() on each command to determine which ones failed
-//     and why.
+//     0 or another exit code declared successful with [WithSuccessExitCodes],
+//     disregarding commands marked with [WithAllowFailure] (if the user
+//     prematurely quit, this will be false even if the terminated commands
+//     responded with exit status 0 on SIGINT/SIGTERM, or were all marked with
+//     [WithAllowFailure]). If it's false, use Err()
+//     or ProcessState() on each command to determine which ones failed and why.
 //   - err is for error from the mrun runner itself, not including errors from
-//     commands.
+//     commands. The exception is fail-fast mode, where a [*FailFastError] is
+//     returned if the commands were aborted.
 //
 // Various options can be used to customize the experience:
 //   - [WithColumns] sets the number of columns in the grid, default to 1.
@@ -71,46 +129,129 @@ func WithFinalView() RunOption {
 //     each pane.
 //   - [WithAutoQuit] turns on auto quitting after all commands are done without user interaction.
 //   - [WithFinalView] leaves a final, non-interactive view of the grid on screen after quitting.
+//   - [WithFailFast] terminates all commands as soon as one fails.
+//   - [WithTimestamps] shows the arrival time of each line of output.
+//   - [WithHighlight] highlights matches of a pattern in the output.
+//   - [WithKeyMap] customizes the key bindings.
+//   - [WithHelpFooter] shows a short help line below the grid.
+//   - [WithTheme] sets the colors and styles of the grid.
+//   - [WithBorder] sets the border style of panes.
+//   - [WithNoWrap] turns off wrapping of long lines.
+//   - [WithBellForwarding] forwards bells in the output to the terminal.
+//   - [WithEventHandler] sets a handler of events of the commands.
+//
+// Run blocks until the grid quits. See [Start] for a non-blocking variant that
+// allows adding and removing commands while the grid is running.
 func Run(commands []*Command, opts ...RunOption) (c []*Command, allSuccessful bool, err error) {
-	c = commands
+	h, err := Start(commands, opts...)
+	if err != nil {
+		return commands, false, err
+	}
+	return h.Wait()
+}
+
+// Handle is a handle to a grid started with [Start].
+type Handle struct {
+	p    *tea.Program
+	done chan struct{}
+
+	// Results, set before done is closed.
+	commands      []*Command
+	allSuccessful bool
+	err           error
+}
+
+// Start is like [Run], but returns immediately with a [Handle] which can be
+// used to add and remove commands while the grid is running, and to wait for
+// the grid to quit.
+func Start(commands []*Command, opts ...RunOption) (*Handle, error) {
 	var o runOpts
 	o.cols = 1
+	o.keyMap = DefaultKeyMap()
 	for _, opt := range opts {
 		opt(&o)
 	}
 
 	if len(commands) == 0 {
-		err = errors.New("commands must not be empty")
-		return
+		return nil, errors.New("commands must not be empty")
 	}
 	if o.cols <= 0 {
-		err = errors.New("columns must be positive")
-		return
+		return nil, errors.New("columns must be positive")
+	}
+	if o.theme == nil {
+		theme := DarkTheme()
+		if os.Getenv("NO_COLOR") != "" {
+			theme = NoColorTheme()
+			o.noColorEnv = true
+		}
+		o.theme = &theme
 	}
-
-	zone.NewGlobal()
 
 	m := newModel(o.cols, commands, o)
-	p := tea.NewProgram(
-		m,
-		tea.WithAltScreen(),
-		tea.WithMouseCellMotion(),
-	)
-	mm, err := p.Run()
+	h := &Handle{
+		p: tea.NewProgram(
+			m,
+			tea.WithAltScreen(),
+			tea.WithMouseCellMotion(),
+			tea.WithOutput(m.output),
+		),
+		done:     make(chan struct{}),
+		commands: commands,
+	}
+	go h.run(m, o)
+	return h, nil
+}
+
+func (h *Handle) run(m model, o runOpts) {
+	defer close(h.done)
+	// The layers are closed only after the final view is rendered, since
+	// scanning zones blocks once a closed manager stops consuming them.
+	defer func() {
+		m.grid.close()
+		m.overlay.close()
+	}()
+	mm, err := h.p.Run()
 	if err != nil {
-		err = fmt.Errorf("bubbletea error: %s", err)
+		h.err = fmt.Errorf("bubbletea error: %s", err)
 		return
 	}
-	allSuccessful = m.executor.allSuccessful()
+	h.allSuccessful = m.executor.allSuccessful()
 	m, ok := mm.(model)
 	if !ok {
-		err = fmt.Errorf("bubbletea error: unexpected model type from Program.Run: expected %T, got %T", m, mm)
+		h.err = fmt.Errorf("bubbletea error: unexpected model type from Program.Run: expected %T, got %T", m, mm)
 		return
 	}
+	h.commands = m.commands()
 	// Reset window title.
 	fmt.Print(ansi.SetWindowTitle(""))
 	if o.printFinalView {
 		fmt.Println(m.finalView())
 	}
-	return
+	if m.abortedBy != nil {
+		h.err = &FailFastError{Command: m.abortedBy}
+	}
+}
+
+// Add adds a command to the grid in a new pane and starts it, recomputing the
+// layout. If all previous commands were done, the grid is no longer considered
+// done until the new command exits too. A command can only be run once; adding
+// a command that is already in the grid has no effect, as does adding a
+// command after the grid has started terminating or has quit.
+func (h *Handle) Add(cmd *Command) {
+	h.p.Send(addCommandMsg{cmd: cmd})
+}
+
+// Remove removes a command's pane from the grid, gracefully terminating the
+// command if it's still running, and recomputes the layout. A removed command
+// is no longer included in the results of [Handle.Wait].
+func (h *Handle) Remove(cmd *Command) {
+	h.p.Send(removeCommandMsg{cmd: cmd})
+}
+
+// Wait blocks until the grid quits, and returns the same results as [Run].
+// The returned commands include those added with [Handle.Add] and exclude those
+// removed with [Handle.Remove].
+func (h *Handle) Wait() (c []*Command, allSuccessful bool, err error) {
+	<-h.done
+	return h.commands, h.allSuccessful, h.err
 }
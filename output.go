@@ -0,0 +1,31 @@
+package mrun
+
+import (
+	"os"
+	"sync"
+)
+
+// terminalOutput is the output of the program. Writes are serialized, so that
+// escape sequences written to the terminal outside of the renderer, e.g. OSC 52
+// and bells, don't interleave with frames. It embeds the file so that the
+// program still detects a terminal.
+type terminalOutput struct {
+	*os.File
+	mu sync.Mutex
+}
+
+func newTerminalOutput(f *os.File) *terminalOutput {
+	return &terminalOutput{File: f}
+}
+
+func (o *terminalOutput) Write(b []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.File.Write(b)
+}
+
+func (o *terminalOutput) WriteString(s string) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.File.WriteString(s)
+}
@@ -0,0 +1,130 @@
+package mrun
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var _procfileLineRegexp = regexp.MustCompile(`^([A-Za-z0-9_-]+):\s*(.+)$`)
+
+// ProcfileEntry is a process type declared in a Procfile.
+type ProcfileEntry struct {
+	Name    string
+	Command string
+}
+
+// ParseProcfile parses the entries of a Procfile, i.e. lines of the form
+//
+//	name: command
+//
+// Blank lines and lines starting with # are ignored.
+func ParseProcfile(r io.Reader) ([]ProcfileEntry, error) {
+	var entries []ProcfileEntry
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(r)
+	lineno := 0
+	for scanner.Scan() {
+		lineno++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		m := _procfileLineRegexp.FindStringSubmatch(line)
+		if m == nil {
+			return nil, fmt.Errorf("%d: invalid line, expected name: command", lineno)
+		}
+		if seen[m[1]] {
+			return nil, fmt.Errorf("%d: duplicate process name %q", lineno, m[1])
+		}
+		seen[m[1]] = true
+		entries = append(entries, ProcfileEntry{Name: m[1], Command: m[2]})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+type procfileOpts struct {
+	envFile  string
+	basePort int
+}
+
+type ProcfileOption func(*procfileOpts)
+
+// WithProcfileEnvFile sets the dotenv file whose variables are set for every
+// process. The default is .env in the directory of the Procfile, if it exists.
+func WithProcfileEnvFile(path string) ProcfileOption {
+	return func(o *procfileOpts) {
+		o.envFile = path
+	}
+}
+
+// WithProcfileBasePort sets the base port for PORT assignment. The default is
+// 5000. A port of 0 disables PORT assignment.
+func WithProcfileBasePort(port int) ProcfileOption {
+	return func(o *procfileOpts) {
+		o.basePort = port
+	}
+}
+
+// LoadProcfile loads commands from a Procfile like foreman does: each process
+// is run with sh in the directory of the Procfile, labeled with its name, with
+// variables from the .env file set, and with PORT set to the base port plus
+// 100 times the index of the process (5000, 5100, 5200, ...).
+func LoadProcfile(path string, opts ...ProcfileOption) ([]*Command, error) {
+	dir := filepath.Dir(path)
+	o := procfileOpts{basePort: 5000}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	entries, err := ParseProcfile(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%w", path, err)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%s: no processes", path)
+	}
+
+	var env []string
+	if o.envFile != "" {
+		env, err = loadDotenv(o.envFile)
+	} else {
+		env, err = loadDotenv(filepath.Join(dir, ".env"))
+		if errors.Is(err, fs.ErrNotExist) {
+			err = nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var commands []*Command
+	for i, e := range entries {
+		cmdEnv := env[:len(env):len(env)]
+		if o.basePort > 0 {
+			cmdEnv = append(cmdEnv, "PORT="+strconv.Itoa(o.basePort+100*i))
+		}
+		commands = append(commands, NewCommandWithShell(
+			e.Command,
+			WithLabel(e.Name),
+			WithEnv(cmdEnv),
+			WithDir(dir),
+		))
+	}
+	return commands, nil
+}
@@ -0,0 +1,136 @@
+package mrun
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseProcfile(t *testing.T) {
+	entries, err := ParseProcfile(strings.NewReader(`# Comment
+web: npm run dev -- --port $PORT
+
+  worker:bundle exec sidekiq
+release-1_a: ./release # not a comment
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ProcfileEntry{
+		{"web", "npm run dev -- --port $PORT"},
+		{"worker", "bundle exec sidekiq"},
+		{"release-1_a", "./release # not a comment"},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("ParseProcfile() = %q, want %q", entries, want)
+	}
+}
+
+func TestParseProcfileErrors(t *testing.T) {
+	tests := []struct {
+		procfile string
+		err      string
+	}{
+		{"web: x\nnot an entry\n", "2: invalid line, expected name: command"},
+		{"web:\n", "1: invalid line, expected name: command"},
+		{"web.1: x\n", "1: invalid line, expected name: command"},
+		{"web: x\n# web: y\nweb: z\n", `3: duplicate process name "web"`},
+	}
+	for _, tt := range tests {
+		_, err := ParseProcfile(strings.NewReader(tt.procfile))
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("ParseProcfile(%q) error = %v, want %q", tt.procfile, err, tt.err)
+		}
+	}
+}
+
+// writeProcfile writes a Procfile and other files to a temporary directory and
+// returns the path of the Procfile.
+func writeProcfile(t *testing.T, procfile string, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	files["Procfile"] = procfile
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return filepath.Join(dir, "Procfile")
+}
+
+func TestLoadProcfile(t *testing.T) {
+	path := writeProcfile(t, "web: ./web\nworker: ./worker\napi: ./api\n", map[string]string{
+		".env":    "FOO=bar\n",
+		"ci.env":  "FOO=ci\n",
+		"bad.env": "FOO='bar\n",
+	})
+	dir := filepath.Dir(path)
+
+	commands, err := LoadProcfile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []struct {
+		label string
+		env   []string
+	}{
+		{"web", []string{"FOO=bar", "PORT=5000"}},
+		{"worker", []string{"FOO=bar", "PORT=5100"}},
+		{"api", []string{"FOO=bar", "PORT=5200"}},
+	} {
+		c := commands[i]
+		if c.label != want.label || !slices.Equal(c.env, want.env) || c.cmd.Dir != dir || !c.shell {
+			t.Errorf("command %d: label = %q, env = %q, dir = %q, shell = %v", i, c.label, c.env, c.cmd.Dir, c.shell)
+		}
+	}
+
+	commands, err = LoadProcfile(path, WithProcfileBasePort(3000), WithProcfileEnvFile(filepath.Join(dir, "ci.env")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env := commands[1].env; !slices.Equal(env, []string{"FOO=ci", "PORT=3100"}) {
+		t.Errorf("with base port and env file: env = %q", env)
+	}
+
+	commands, err = LoadProcfile(path, WithProcfileBasePort(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env := commands[0].env; !slices.Equal(env, []string{"FOO=bar"}) {
+		t.Errorf("with base port 0: env = %q", env)
+	}
+
+	_, err = LoadProcfile(path, WithProcfileEnvFile(filepath.Join(dir, "bad.env")))
+	if err == nil || !strings.HasSuffix(err.Error(), "bad.env:1: unterminated quoted value") {
+		t.Errorf("with invalid env file: error = %v", err)
+	}
+	_, err = LoadProcfile(path, WithProcfileEnvFile(filepath.Join(dir, "missing.env")))
+	if !os.IsNotExist(err) {
+		t.Errorf("with missing env file: error = %v, want not exist", err)
+	}
+}
+
+func TestLoadProcfileWithoutEnvFile(t *testing.T) {
+	path := writeProcfile(t, "web: ./web\n", map[string]string{})
+	commands, err := LoadProcfile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env := commands[0].env; !slices.Equal(env, []string{"PORT=5000"}) {
+		t.Errorf("env = %q", env)
+	}
+}
+
+func TestLoadProcfileErrors(t *testing.T) {
+	path := writeProcfile(t, "web: ./web\nweb: ./web\n", map[string]string{})
+	if _, err := LoadProcfile(path); err == nil || err.Error() != path+`:2: duplicate process name "web"` {
+		t.Errorf("duplicate: error = %v", err)
+	}
+	path = writeProcfile(t, "# Nothing\n", map[string]string{})
+	if _, err := LoadProcfile(path); err == nil || err.Error() != path+": no processes" {
+		t.Errorf("empty: error = %v", err)
+	}
+}
@@ -0,0 +1,130 @@
+package mrun
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/x/ansi"
+)
+
+// Maximum width of progress bars in the bottom border of panes.
+const _progressBarWidth = 20
+
+var (
+	_percentRegexp = regexp.MustCompile(`(\d+(?:\.\d+)?)\s*%`)
+	_countRegexp   = regexp.MustCompile(`(\d+)\s*/\s*(\d+)`)
+)
+
+// ProgressFunc extracts the progress of a command, between 0 and 1, from a
+// line of its output with ANSI escape sequences stripped. ok is false if the
+// line doesn't show progress.
+type ProgressFunc func(line string) (progress float64, ok bool)
+
+// ParseProgress is the built-in [ProgressFunc]. It recognizes percentages up
+// to 100% like "42%" or "42.5%", and otherwise counts like "3/10" where the
+// first number is at most the second. The last match in the line is used.
+// Numbers that are part of a longer run of slashes, dots or digits, like the
+// dates 10/19/2024 and 2024/10/19, the path src/1/2 or the version 1.2/3, are
+// not counts.
+func ParseProgress(line string) (progress float64, ok bool) {
+	percents := _percentRegexp.FindAllStringSubmatch(line, -1)
+	for i := len(percents) - 1; i >= 0; i-- {
+		percent, err := strconv.ParseFloat(percents[i][1], 64)
+		if err == nil && percent <= 100 {
+			return percent / 100, true
+		}
+	}
+	counts := _countRegexp.FindAllStringSubmatchIndex(line, -1)
+	for i := len(counts) - 1; i >= 0; i-- {
+		loc := counts[i]
+		if !isCountDelimited(line, loc[0], loc[1]) {
+			continue
+		}
+		x, err1 := strconv.Atoi(line[loc[2]:loc[3]])
+		y, err2 := strconv.Atoi(line[loc[4]:loc[5]])
+		if err1 == nil && err2 == nil && y > 0 && x <= y {
+			return float64(x) / float64(y), true
+		}
+	}
+	return 0, false
+}
+
+// isCountDelimited reports whether line[start:end], a count like 3/10, isn't
+// part of a longer run of slashes, dots or digits. A dot ending a sentence
+// after the count is fine.
+func isCountDelimited(line string, start, end int) bool {
+	const run = "./0123456789"
+	if start > 0 && strings.IndexByte(run, line[start-1]) >= 0 {
+		return false
+	}
+	if end < len(line) && strings.IndexByte(run, line[end]) >= 0 {
+		return line[end] == '.' && (end+1 == len(line) || line[end+1] == ' ')
+	}
+	return true
+}
+
+// WithProgress extracts the progress of the command from its output with f, or
+// [ParseProgress] if f is nil. The progress is shown as a bar in the bottom
+// border of the pane while the command is running, and the overall progress of
+// all commands with WithProgress is shown in the window title.
+func WithProgress(f ProgressFunc) CommandOption {
+	return func(c *Command) {
+		if f == nil {
+			f = ParseProgress
+		}
+		c.progress = f
+	}
+}
+
+// updateProgress extracts the progress of the pane's command from a line of
+// output.
+func (p *modelPane) updateProgress(line string) {
+	if p.cmd.progress == nil {
+		return
+	}
+	if progress, ok := p.cmd.progress(ansi.Strip(line)); ok {
+		p.progress = min(max(progress, 0), 1)
+		p.hasProgress = true
+	}
+}
+
+// progressBar renders the progress bar of the pane at most width wide, e.g.
+// "━━━━━━━━──────────── 42%", or "" if there's no progress to show.
+func (p *modelPane) progressBar(width int, style func(string) string) string {
+	if !p.hasProgress || !p.running() {
+		return ""
+	}
+	percent := fmt.Sprintf(" %.0f%% ", p.progress*100)
+	barWidth := min(_progressBarWidth, width-len(percent)-1)
+	if barWidth <= 0 {
+		return ""
+	}
+	filled := int(p.progress * float64(barWidth))
+	return " " + p.styles.success.Render(strings.Repeat("━", filled)) +
+		style(strings.Repeat("─", barWidth-filled)+percent)
+}
+
+// overallProgress returns the average progress of the commands with
+// [WithProgress], counting successfully exited commands as complete, and
+// whether there are such commands.
+func (m model) overallProgress() (float64, bool) {
+	var sum float64
+	var n int
+	for _, pane := range m.panes {
+		if pane.cmd.progress == nil {
+			continue
+		}
+		n++
+		if pane.exited && pane.cmd.isSuccessExitCode(pane.exitCode) {
+			sum++
+		} else {
+			sum += pane.progress
+		}
+	}
+	if n == 0 {
+		return 0, false
+	}
+	return sum / float64(n), true
+}
@@ -0,0 +1,45 @@
+package mrun
+
+import "testing"
+
+func TestParseProgress(t *testing.T) {
+	tests := []struct {
+		line     string
+		progress float64
+		ok       bool
+	}{
+		{"downloading 42%", 0.42, true},
+		{"42.5 % done", 0.425, true},
+		{"100%", 1, true},
+		{"0%", 0, true},
+		{"3/10", 0.3, true},
+		{"[3 / 4] compiling", 0.75, true},
+		{"step 1/2 3/4", 0.75, true},
+		{"done 4/4.", 1, true},
+		// The last match wins, and percentages win over counts.
+		{"10% 20%", 0.2, true},
+		{"3/4 10%", 0.1, true},
+		// Implausible values are skipped in favor of earlier matches.
+		{"50% 200%", 0.5, true},
+		{"1/2 5/3", 0.5, true},
+		{"200%", 0, false},
+		{"5/3", 0, false},
+		{"1/0", 0, false},
+		// Dates, paths, versions and other false positives.
+		{"2024/10/19", 0, false},
+		{"10/19/2024", 0, false},
+		{"built 10/19/2024 12:00", 0, false},
+		{"src/1/2/main.go", 0, false},
+		{"go1.2/3", 0, false},
+		{"3.5/10", 0, false},
+		{"GOOS=linux/amd64", 0, false},
+		{"no progress here", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		progress, ok := ParseProgress(tt.line)
+		if ok != tt.ok || progress != tt.progress {
+			t.Errorf("ParseProgress(%q) = %v, %v; want %v, %v", tt.line, progress, ok, tt.progress, tt.ok)
+		}
+	}
+}
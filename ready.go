@@ -0,0 +1,109 @@
+package mrun
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/charmbracelet/x/ansi"
+)
+
+// Interval between polls of port and file readiness probes.
+const _readyPollInterval = 250 * time.Millisecond
+
+// ReadyProbe is a condition used to determine when a command is "up", as
+// opposed to merely running. Create one with [ReadyOnOutput], [ReadyOnPort] or
+// [ReadyOnFile], and attach it to a command with [WithReadyWhen].
+type ReadyProbe struct {
+	pattern *regexp.Regexp
+	port    int
+	path    string
+}
+
+// ReadyOnOutput returns a probe that succeeds when a line of the command's
+// output matches pattern. ANSI escape sequences are stripped from the line
+// before matching.
+func ReadyOnOutput(pattern *regexp.Regexp) ReadyProbe {
+	return ReadyProbe{pattern: pattern}
+}
+
+// ReadyOnPort returns a probe that succeeds when a TCP connection can be
+// established to the given port on localhost.
+func ReadyOnPort(port int) ReadyProbe {
+	return ReadyProbe{port: port}
+}
+
+// ReadyOnFile returns a probe that succeeds when a file exists at path. A
+// relative path is resolved against the working directory of the command.
+func ReadyOnFile(path string) ReadyProbe {
+	return ReadyProbe{path: path}
+}
+
+// WithReadyWhen attaches readiness probes to the command. The command is
+// considered ready as soon as any of the probes succeeds, and the pane shows
+// STARTING or READY in its bottom border while the command is running. An
+// [EventReady] is emitted when the command becomes ready (see
+// [WithEventHandler]).
+//
+// Commands without readiness probes are considered ready as soon as they are
+// started. See [Command.Ready].
+func WithReadyWhen(probes ...ReadyProbe) CommandOption {
+	return func(c *Command) {
+		c.probes = append(c.probes, probes...)
+	}
+}
+
+// matchesOutput reports whether line satisfies one of the output probes.
+func (c *Command) matchesOutput(line []byte) bool {
+	var stripped string
+	for _, p := range c.probes {
+		if p.pattern == nil {
+			continue
+		}
+		if stripped == "" {
+			stripped = ansi.Strip(string(line))
+		}
+		if p.pattern.MatchString(stripped) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasPollingProbes reports whether any of the probes need to be polled, i.e.
+// port and file probes.
+func (c *Command) hasPollingProbes() bool {
+	for _, p := range c.probes {
+		if p.port > 0 || p.path != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// pollReady runs the port and file probes once and reports whether any of them
+// succeeded.
+func (c *Command) pollReady() bool {
+	for _, p := range c.probes {
+		if p.port > 0 {
+			conn, err := net.DialTimeout("tcp", fmt.Sprintf("localhost:%d", p.port), _readyPollInterval)
+			if err == nil {
+				_ = conn.Close()
+				return true
+			}
+		}
+		if p.path != "" {
+			path := p.path
+			if !filepath.IsAbs(path) && c.cmd.Dir != "" {
+				path = filepath.Join(c.cmd.Dir, path)
+			}
+			if _, err := os.Stat(path); err == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package mrun
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// ErrStallTimeout is wrapped by the error of a command terminated due to
+// [WithStallTimeout].
+var ErrStallTimeout = errors.New("stall timeout")
+
+// WithStallWarning marks the command's pane as stalled, e.g. "STALLED 2m05s",
+// when the command has produced no output for d, until it produces output
+// again. An [EventStalled] is emitted (see [WithEventHandler]).
+func WithStallWarning(d time.Duration) CommandOption {
+	return func(c *Command) {
+		c.stallWarning = d
+	}
+}
+
+// WithStallTimeout gracefully terminates the command when it has produced no
+// output for d, like a timeout. The command's error then wraps
+// [ErrStallTimeout], and it's considered failed (see [WithFailFast]). An
+// [EventStallTimeout] is emitted (see [WithEventHandler]).
+func WithStallTimeout(d time.Duration) CommandOption {
+	return func(c *Command) {
+		c.stallTimeout = d
+	}
+}
+
+// hasStallChecks reports whether the command is checked for stalls.
+func (c *Command) hasStallChecks() bool {
+	return c.stallWarning > 0 || c.stallTimeout > 0
+}
+
+// sinceOutput returns the time since the last output of the pane, or since the
+// command was started if there's no output yet.
+func (p *modelPane) sinceOutput() time.Duration {
+	last := p.lastOutput
+	if last.IsZero() {
+		last = p.cmd.startTime
+	}
+	return time.Since(last)
+}
+
+// checkStalls marks panes whose commands have produced no output for the stall
+// warning duration, and terminates those exceeding the stall timeout.
+func (m *model) checkStalls() tea.Cmd {
+	if m.terminating {
+		return nil
+	}
+	var cmds []tea.Cmd
+	for idx := range m.panes {
+		pane := &m.panes[idx]
+		c := pane.cmd
+		if !c.hasStallChecks() || !pane.running() || c.startTime.IsZero() {
+			continue
+		}
+		since := pane.sinceOutput()
+		if c.stallWarning > 0 && !pane.stalled && since >= c.stallWarning {
+			pane.stalled = true
+			m.emit(EventStalled, c)
+		}
+		if c.stallTimeout > 0 && !pane.stallTimedOut && since >= c.stallTimeout {
+			if cmd := m.stopPane(idx); cmd != nil {
+				pane.stallTimedOut = true
+				m.emit(EventStallTimeout, c)
+				cmds = append(cmds, cmd)
+			}
+		}
+	}
+	return tea.Batch(cmds...)
+}
+
+// stallTimeoutError returns the error of a command terminated due to the stall
+// timeout.
+func stallTimeoutError(c *Command) error {
+	return fmt.Errorf("%w: no output for %s", ErrStallTimeout, c.stallTimeout)
+}
@@ -0,0 +1,252 @@
+package mrun
+
+import (
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+)
+
+// Theme defines the colors and text styles of the grid. Start from one of the
+// presets, e.g. [DarkTheme], and override fields as needed, then pass it to
+// [WithTheme]. Only text attributes (colors, bold, etc.) of the styles are
+// used; sizes, padding and borders are managed by the grid.
+type Theme struct {
+	// Border colors of the active and inactive panes, and of inactive panes
+	// with unseen output.
+	ActiveBorder   lipgloss.TerminalColor
+	InactiveBorder lipgloss.TerminalColor
+	ActivityBorder lipgloss.TerminalColor
+	// Text in the borders of the active and inactive panes: labels, scroll
+	// percentages, etc.
+	ActiveOverlay   lipgloss.Style
+	InactiveOverlay lipgloss.Style
+	// Command line header (see [WithCommandLines]); its foreground color is
+	// also used for the line under it.
+	CommandLine lipgloss.Style
+	// Exit statuses and readiness; Error is also used for errors running
+	// commands, and Warning for failures allowed with [WithAllowFailure].
+	Success lipgloss.Style
+	Warning lipgloss.Style
+	Error   lipgloss.Style
+	// Timestamps gutter (see [WithTimestamps]).
+	Timestamp lipgloss.Style
+	// Dialog and feedback text; its background color is used for the whole
+	// dialog box.
+	Dialog         lipgloss.Style
+	ActiveButton   lipgloss.Style
+	InactiveButton lipgloss.Style
+	// Cursor and selection in copy mode.
+	CopyCursor    lipgloss.Style
+	CopySelection lipgloss.Style
+}
+
+// DarkTheme returns the default theme, for terminals with a dark background.
+func DarkTheme() Theme {
+	var (
+		activeBorder   = lipgloss.Color("168") // HotPink3
+		inactiveBorder = lipgloss.Color("241") // Grey39
+	)
+	return Theme{
+		ActiveBorder:    activeBorder,
+		InactiveBorder:  inactiveBorder,
+		ActivityBorder:  lipgloss.Color("179"), // LightGoldenrod3
+		ActiveOverlay:   lipgloss.NewStyle().Foreground(activeBorder),
+		InactiveOverlay: lipgloss.NewStyle().Foreground(inactiveBorder),
+		CommandLine:     lipgloss.NewStyle().Foreground(lipgloss.Color("75")),  // SteelBlue1
+		Success:         lipgloss.NewStyle().Foreground(lipgloss.Color("78")),  // SeaGreen3
+		Warning:         lipgloss.NewStyle().Foreground(lipgloss.Color("220")), // Gold1
+		Error:           lipgloss.NewStyle().Foreground(lipgloss.Color("196")), // Red1
+		Timestamp:       lipgloss.NewStyle().Foreground(lipgloss.Color("244")), // Grey50
+		Dialog: lipgloss.NewStyle().
+			Foreground(lipgloss.Color("255")). // Grey93
+			Background(lipgloss.Color("56")),  // Purple3
+		ActiveButton: lipgloss.NewStyle().
+			Foreground(lipgloss.Color("255")). // Grey93
+			Background(lipgloss.Color("168")), // HotPink3
+		InactiveButton: lipgloss.NewStyle().
+			Foreground(lipgloss.Color("255")). // Grey93
+			Background(lipgloss.Color("246")), // Grey58
+		CopyCursor:    lipgloss.NewStyle().Reverse(true).Foreground(activeBorder),
+		CopySelection: lipgloss.NewStyle().Reverse(true),
+	}
+}
+
+// LightTheme returns a theme for terminals with a light background.
+func LightTheme() Theme {
+	var (
+		activeBorder   = lipgloss.Color("162") // DeepPink3
+		inactiveBorder = lipgloss.Color("248") // Grey66
+	)
+	return Theme{
+		ActiveBorder:    activeBorder,
+		InactiveBorder:  inactiveBorder,
+		ActivityBorder:  lipgloss.Color("136"), // DarkGoldenrod
+		ActiveOverlay:   lipgloss.NewStyle().Foreground(activeBorder),
+		InactiveOverlay: lipgloss.NewStyle().Foreground(inactiveBorder),
+		CommandLine:     lipgloss.NewStyle().Foreground(lipgloss.Color("25")),  // DeepSkyBlue4
+		Success:         lipgloss.NewStyle().Foreground(lipgloss.Color("28")),  // Green4
+		Warning:         lipgloss.NewStyle().Foreground(lipgloss.Color("130")), // DarkOrange3
+		Error:           lipgloss.NewStyle().Foreground(lipgloss.Color("160")), // Red3
+		Timestamp:       lipgloss.NewStyle().Foreground(lipgloss.Color("243")), // Grey46
+		Dialog: lipgloss.NewStyle().
+			Foreground(lipgloss.Color("16")).  // Grey0
+			Background(lipgloss.Color("189")), // LightSteelBlue1
+		ActiveButton: lipgloss.NewStyle().
+			Foreground(lipgloss.Color("231")). // Grey100
+			Background(lipgloss.Color("162")), // DeepPink3
+		InactiveButton: lipgloss.NewStyle().
+			Foreground(lipgloss.Color("16")).  // Grey0
+			Background(lipgloss.Color("250")), // Grey74
+		CopyCursor:    lipgloss.NewStyle().Reverse(true).Foreground(activeBorder),
+		CopySelection: lipgloss.NewStyle().Reverse(true),
+	}
+}
+
+// HighContrastTheme returns a theme using bold text and the bright colors of
+// the basic 16-color palette, which terminals usually render with good
+// contrast.
+func HighContrastTheme() Theme {
+	var (
+		activeBorder   = lipgloss.Color("11") // Bright yellow
+		inactiveBorder = lipgloss.Color("7")  // White
+	)
+	bold := lipgloss.NewStyle().Bold(true)
+	return Theme{
+		ActiveBorder:    activeBorder,
+		InactiveBorder:  inactiveBorder,
+		ActivityBorder:  lipgloss.Color("14"), // Bright cyan
+		ActiveOverlay:   bold.Foreground(activeBorder),
+		InactiveOverlay: lipgloss.NewStyle().Foreground(inactiveBorder),
+		CommandLine:     bold.Foreground(lipgloss.Color("14")), // Bright cyan
+		Success:         bold.Foreground(lipgloss.Color("10")), // Bright green
+		Warning:         bold.Foreground(lipgloss.Color("11")), // Bright yellow
+		Error:           bold.Foreground(lipgloss.Color("9")),  // Bright red
+		Timestamp:       lipgloss.NewStyle().Foreground(lipgloss.Color("7")),
+		Dialog:          bold.Foreground(lipgloss.Color("15")).Background(lipgloss.Color("4")),
+		ActiveButton:    bold.Foreground(lipgloss.Color("0")).Background(lipgloss.Color("11")),
+		InactiveButton:  bold.Foreground(lipgloss.Color("0")).Background(lipgloss.Color("7")),
+		CopyCursor:      bold.Reverse(true).Foreground(activeBorder),
+		CopySelection:   lipgloss.NewStyle().Reverse(true),
+	}
+}
+
+// NoColorTheme returns a theme without colors, using text attributes like
+// bold and reverse video to distinguish elements. It's the default if the
+// NO_COLOR environment variable is set (see https://no-color.org).
+func NoColorTheme() Theme {
+	return Theme{
+		ActiveBorder:    lipgloss.NoColor{},
+		InactiveBorder:  lipgloss.NoColor{},
+		ActivityBorder:  lipgloss.NoColor{},
+		ActiveOverlay:   lipgloss.NewStyle().Bold(true),
+		InactiveOverlay: lipgloss.NewStyle(),
+		CommandLine:     lipgloss.NewStyle().Bold(true),
+		Success:         lipgloss.NewStyle(),
+		Warning:         lipgloss.NewStyle().Bold(true),
+		Error:           lipgloss.NewStyle().Bold(true),
+		Timestamp:       lipgloss.NewStyle().Faint(true),
+		Dialog:          lipgloss.NewStyle().Reverse(true),
+		ActiveButton:    lipgloss.NewStyle().Bold(true),
+		InactiveButton:  lipgloss.NewStyle().Reverse(true),
+		CopyCursor:      lipgloss.NewStyle().Bold(true).Reverse(true),
+		CopySelection:   lipgloss.NewStyle().Reverse(true),
+	}
+}
+
+// WithTheme sets the theme of the grid. The default is [DarkTheme], or
+// [NoColorTheme] if the NO_COLOR environment variable is set.
+func WithTheme(theme Theme) RunOption {
+	return func(o *runOpts) {
+		o.theme = &theme
+	}
+}
+
+// styles are the styles of the grid derived from a theme.
+type styles struct {
+	activePane      lipgloss.Style
+	inactivePane    lipgloss.Style
+	activityPane    lipgloss.Style
+	activeOverlay   lipgloss.Style
+	inactiveOverlay lipgloss.Style
+	command         lipgloss.Style
+	success         lipgloss.Style
+	warning         lipgloss.Style
+	error           lipgloss.Style
+	timestamp       lipgloss.Style
+	dialogBox       lipgloss.Style
+	dialogPrompt    lipgloss.Style
+	dialogBg        lipgloss.TerminalColor
+	activeButton    lipgloss.Style
+	inactiveButton  lipgloss.Style
+	buttonSpacer    lipgloss.Style
+	copyCursor      lipgloss.Style
+	copySelection   lipgloss.Style
+	helpBox         lipgloss.Style
+	// The renderer of all the styles, scoped to the grid.
+	renderer *lipgloss.Renderer
+}
+
+// newRenderer returns the renderer of the styles of the grid, writing to out.
+// lipgloss renders no text attributes at all if NO_COLOR is set, which would
+// make e.g. the selected dialog button of NoColorTheme invisible, so
+// attributes (but not colors, which the theme doesn't use) are enabled if the
+// terminal supports them.
+func newRenderer(out *terminalOutput, noColorEnv bool) *lipgloss.Renderer {
+	r := lipgloss.NewRenderer(out)
+	if noColorEnv && r.ColorProfile() == termenv.Ascii && r.Output().ColorProfile() != termenv.Ascii {
+		r.SetColorProfile(termenv.ANSI)
+	}
+	return r
+}
+
+// newStyles derives the styles of the grid from a theme. The styles of the
+// theme, which are usually bound to the default renderer, are rendered with r.
+func newStyles(t Theme, border PaneBorder, r *lipgloss.Renderer) *styles {
+	t = t.withRenderer(r)
+	paneStyle := paneStyle(r, border)
+	dialogBg := t.Dialog.GetBackground()
+	// The reverse attribute of the dialog style (e.g. in NoColorTheme) is
+	// applied to the whole box like the background.
+	dialogBox := r.NewStyle().Padding(1).Background(dialogBg).Reverse(t.Dialog.GetReverse())
+	buttonStyle := r.NewStyle().Padding(0, 1)
+	return &styles{
+		activePane:      paneStyle.BorderForeground(t.ActiveBorder),
+		inactivePane:    paneStyle.BorderForeground(t.InactiveBorder),
+		activityPane:    paneStyle.BorderForeground(t.ActivityBorder),
+		activeOverlay:   t.ActiveOverlay,
+		inactiveOverlay: t.InactiveOverlay,
+		command: t.CommandLine.
+			BorderStyle(lipgloss.NormalBorder()).
+			BorderForeground(t.CommandLine.GetForeground()).
+			BorderBottom(true),
+		success:        t.Success,
+		warning:        t.Warning,
+		error:          t.Error,
+		timestamp:      t.Timestamp,
+		dialogBox:      dialogBox,
+		dialogPrompt:   t.Dialog.Width(_dialogWidth - 2).Align(lipgloss.Center),
+		dialogBg:       dialogBg,
+		activeButton:   buttonStyle.Inherit(t.ActiveButton),
+		inactiveButton: buttonStyle.Inherit(t.InactiveButton),
+		buttonSpacer:   r.NewStyle().Background(dialogBg).Reverse(t.Dialog.GetReverse()),
+		copyCursor:     t.CopyCursor,
+		copySelection:  t.CopySelection,
+		helpBox: r.NewStyle().
+			Border(lipgloss.RoundedBorder()).
+			BorderForeground(t.ActiveBorder).
+			Padding(0, 1),
+		renderer: r,
+	}
+}
+
+// withRenderer returns a copy of the theme with its styles bound to r.
+func (t Theme) withRenderer(r *lipgloss.Renderer) Theme {
+	for _, s := range []*lipgloss.Style{
+		&t.ActiveOverlay, &t.InactiveOverlay, &t.CommandLine,
+		&t.Success, &t.Warning, &t.Error, &t.Timestamp,
+		&t.Dialog, &t.ActiveButton, &t.InactiveButton,
+		&t.CopyCursor, &t.CopySelection,
+	} {
+		*s = s.Renderer(r)
+	}
+	return t
+}
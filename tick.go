@@ -0,0 +1,30 @@
+package mrun
+
+import (
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Interval of ticks refreshing running durations and checking for stalls.
+const _tickInterval = time.Second
+
+// tickMsg refreshes running durations shown in the panes, and checks for
+// stalled commands.
+type tickMsg struct{}
+
+func tick() tea.Cmd {
+	return tea.Tick(_tickInterval, func(time.Time) tea.Msg {
+		return tickMsg{}
+	})
+}
+
+// startTicking returns a command starting ticks refreshing running durations
+// and checking for stalls, unless they are already running.
+func (m *model) startTicking() tea.Cmd {
+	if m.ticking || !m.ready {
+		return nil
+	}
+	m.ticking = true
+	return tick()
+}
@@ -0,0 +1,143 @@
+package mrun
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/muesli/reflow/truncate"
+	"github.com/muesli/reflow/wrap"
+)
+
+// Number of columns scrolled horizontally at a time in no-wrap mode.
+const _horizontalScrollStep = 4
+
+// WithNoWrap turns off wrapping of long lines in all panes. Instead, lines are
+// cut at the edge of the pane, which can be scrolled horizontally. Wrapping can
+// be toggled for each pane at runtime with the w key.
+func WithNoWrap() RunOption {
+	return func(o *runOpts) {
+		o.noWrap = true
+	}
+}
+
+// WithCommandNoWrap turns off wrapping of long lines in the command's pane,
+// like [WithNoWrap].
+func WithCommandNoWrap() CommandOption {
+	return func(c *Command) {
+		c.noWrap = true
+	}
+}
+
+// wrapLine splits a line of output into rows of the pane: wrapped to width, or
+// a single row in no-wrap mode, which is cut when the content is set.
+func (p *modelPane) wrapLine(text string, width int) []string {
+	if p.noWrap {
+		p.contentWidth = max(p.contentWidth, ansi.StringWidth(text))
+		return []string{text}
+	}
+	return strings.Split(wrap.String(text, width), "\n")
+}
+
+// textWidth returns the width of the viewport available to output, i.e.
+// without the timestamps gutter.
+func (p *modelPane) textWidth() int {
+	return max(p.vw-p.gutterWidth, 1)
+}
+
+// maxXOffset returns the maximum horizontal scroll offset in no-wrap mode.
+func (p *modelPane) maxXOffset() int {
+	return max(p.contentWidth-p.textWidth(), 0)
+}
+
+// scrollHorizontally scrolls the pane by delta columns in no-wrap mode.
+func (p *modelPane) scrollHorizontally(delta int) {
+	if !p.noWrap {
+		return
+	}
+	p.setXOffset(p.xOffset + delta)
+}
+
+func (p *modelPane) setXOffset(n int) {
+	n = clamp(n, 0, p.maxXOffset())
+	if n != p.xOffset {
+		p.xOffset = n
+		p.setContent()
+	}
+}
+
+// toggleWrap toggles between wrapping long lines and no-wrap mode.
+func (p *modelPane) toggleWrap() {
+	p.noWrap = !p.noWrap
+	p.xOffset = 0
+	atBottom := p.v.AtBottom()
+	p.refreshContent()
+	if atBottom {
+		p.v.GotoBottom()
+	}
+}
+
+// cutContent cuts the rows of content to the viewport in no-wrap mode, scrolled
+// by the horizontal offset. The command line header and the timestamps gutter
+// are not scrolled.
+func (p *modelPane) cutContent(content string) string {
+	if !p.noWrap {
+		return content
+	}
+	rows := strings.Split(content, "\n")
+	for i, row := range rows {
+		if i < p.headerRows {
+			continue
+		}
+		var gutter string
+		if p.gutterWidth > 0 {
+			gutter = truncate.String(row, uint(p.gutterWidth))
+			row = cutLeft(row, p.gutterWidth)
+		}
+		if p.xOffset > 0 {
+			row = cutLeft(row, p.xOffset)
+		}
+		rows[i] = gutter + truncate.String(row, uint(p.textWidth()))
+	}
+	return strings.Join(rows, "\n")
+}
+
+// scrollToCopyCursor scrolls horizontally to keep the cursor visible in copy
+// mode.
+func (p *modelPane) scrollToCopyCursor() {
+	if !p.noWrap {
+		return
+	}
+	col := p.copy.col - p.gutterWidth
+	switch {
+	case col < p.xOffset:
+		p.xOffset = max(col, 0)
+	case col >= p.xOffset+p.textWidth():
+		p.xOffset = min(col-p.textWidth()+1, p.maxXOffset())
+	}
+}
+
+// xOffsetIndicator returns the horizontal offset indicator shown in the bottom
+// border in no-wrap mode, e.g. "↔12/80" if scrolled by 12 of 80 columns.
+func (p *modelPane) xOffsetIndicator() string {
+	if !p.noWrap || p.maxXOffset() == 0 {
+		return ""
+	}
+	return fmt.Sprintf("↔%d/%d", p.xOffset, p.maxXOffset())
+}
+
+// horizontalWheelDelta returns the number of columns to scroll horizontally for
+// a mouse event: shift+wheel, or a horizontal wheel. It's 0 for other events.
+func horizontalWheelDelta(msg tea.MouseMsg) int {
+	if msg.Action != tea.MouseActionPress {
+		return 0
+	}
+	switch {
+	case msg.Button == tea.MouseButtonWheelLeft, msg.Shift && msg.Button == tea.MouseButtonWheelUp:
+		return -_horizontalScrollStep
+	case msg.Button == tea.MouseButtonWheelRight, msg.Shift && msg.Button == tea.MouseButtonWheelDown:
+		return _horizontalScrollStep
+	}
+	return 0
+}